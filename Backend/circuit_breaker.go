@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BreakerState is the state of a server's circuit breaker.
+type BreakerState int32
+
+const (
+	BreakerClosed   BreakerState = iota // Traffic flows, results are tracked
+	BreakerOpen                         // Server is out of selection until OpenDuration passes
+	BreakerHalfOpen                     // A few probes decide whether to close or reopen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// breakerBuckets is how many slices the rolling window is split into.
+const breakerBuckets = 10
+
+// CircuitBreakerOpts configures the breaker given to every server of a pool.
+// Leaving both FailureRate and SlowThreshold at zero disables it.
+type CircuitBreakerOpts struct {
+	// FailureRate opens the breaker when this fraction (0-1] of results in
+	// the window failed: dial errors, failed requests and 5xx responses.
+	FailureRate float64
+	// SlowThreshold marks results slower than this as slow; SlowRate
+	// (defaults to 0.5) is the fraction of slow results that opens the
+	// breaker.
+	SlowThreshold time.Duration
+	SlowRate      float64
+	Window        time.Duration // Rolling window results are counted over, defaults to 10s
+	MinRequests   int           // Results needed in the window before it can open, defaults to 10
+	OpenDuration  time.Duration // How long an open breaker keeps the server out, defaults to 30s
+	// HalfOpenProbes is how many requests a half-open breaker lets through at
+	// once, and how many must succeed to close it (defaults to 3).
+	HalfOpenProbes int
+}
+
+// CircuitBreaker removes a server from selection while it is failing or slow.
+// Selection reads its state without locking; results are recorded under a
+// mutex.
+type CircuitBreaker struct {
+	CircuitBreakerOpts
+	Address string
+
+	state     atomic.Int32
+	openUntil atomic.Int64 // Unix nanoseconds
+	probes    atomic.Int32 // Half-open probes in flight
+
+	mu        sync.Mutex
+	buckets   [breakerBuckets]breakerBucket
+	successes int // Successful half-open probes
+}
+
+type breakerBucket struct {
+	start    int64 // Unix nanoseconds, rounded down to the bucket width
+	total    int
+	failures int
+	slow     int
+}
+
+// NewCircuitBreaker returns a breaker for the server at address, or nil if
+// opts disables it. A nil breaker always allows traffic.
+func NewCircuitBreaker(address string, opts CircuitBreakerOpts) *CircuitBreaker {
+	if opts.FailureRate <= 0 && opts.SlowThreshold <= 0 {
+		return nil
+	}
+	if opts.SlowRate <= 0 {
+		opts.SlowRate = 0.5
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 10
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = 30 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 3
+	}
+
+	return &CircuitBreaker{CircuitBreakerOpts: opts, Address: address}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	return BreakerState(b.state.Load())
+}
+
+// Allows reports whether the server may be selected: the breaker is closed,
+// is open but due for probing, or is half-open with a probe slot free.
+func (b *CircuitBreaker) Allows() bool {
+	switch b.State() {
+	case BreakerOpen:
+		return time.Now().UnixNano() >= b.openUntil.Load()
+	case BreakerHalfOpen:
+		return int(b.probes.Load()) < b.HalfOpenProbes
+	}
+	return true
+}
+
+// admit is called once a server has been picked. It moves a due open breaker
+// to half-open and takes a probe slot, failing if none is free.
+func (b *CircuitBreaker) admit() bool {
+	if b == nil {
+		return true
+	}
+
+	if b.State() == BreakerOpen {
+		if time.Now().UnixNano() < b.openUntil.Load() {
+			return false
+		}
+		b.mu.Lock()
+		if b.State() == BreakerOpen {
+			b.probes.Store(0)
+			b.successes = 0
+			b.state.Store(int32(BreakerHalfOpen))
+			log.Printf("[CircuitBreaker] %s half-open, probing", b.Address)
+		}
+		b.mu.Unlock()
+	}
+
+	if b.State() != BreakerHalfOpen {
+		return true
+	}
+	if int(b.probes.Add(1)) > b.HalfOpenProbes {
+		b.probes.Add(-1)
+		return false
+	}
+	return true
+}
+
+// Record adds the outcome of a connection or request and how long it took to
+// get an answer, opening or closing the breaker as needed.
+func (b *CircuitBreaker) Record(ok bool, latency time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	slow := b.SlowThreshold > 0 && latency >= b.SlowThreshold
+
+	switch b.State() {
+	case BreakerOpen:
+		// Result of a request admitted before the breaker opened
+		return
+
+	case BreakerHalfOpen:
+		if b.probes.Load() > 0 {
+			b.probes.Add(-1)
+		}
+		if !ok || slow {
+			b.open(now, "probe failed")
+			return
+		}
+		b.successes++
+		if b.successes >= b.HalfOpenProbes {
+			b.buckets = [breakerBuckets]breakerBucket{}
+			b.state.Store(int32(BreakerClosed))
+			log.Printf("[CircuitBreaker] %s closed after %d successful probes", b.Address, b.successes)
+		}
+		return
+	}
+
+	bucket := b.bucket(now)
+	bucket.total++
+	if !ok {
+		bucket.failures++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	total, failures, slowCount := b.counts(now)
+	if total < b.MinRequests {
+		return
+	}
+	switch {
+	case b.FailureRate > 0 && float64(failures)/float64(total) >= b.FailureRate:
+		b.open(now, "failure rate exceeded")
+	case b.SlowThreshold > 0 && float64(slowCount)/float64(total) >= b.SlowRate:
+		b.open(now, "slow response rate exceeded")
+	}
+}
+
+// open must be called with mu held.
+func (b *CircuitBreaker) open(now time.Time, reason string) {
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.openUntil.Store(now.Add(b.OpenDuration).UnixNano())
+	b.state.Store(int32(BreakerOpen))
+	log.Printf("[CircuitBreaker] %s open for %v: %s", b.Address, b.OpenDuration, reason)
+}
+
+// bucket returns the bucket for now, resetting it if it held an older slice.
+func (b *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := int64(b.Window) / breakerBuckets
+	start := now.UnixNano() / width * width
+	bucket := &b.buckets[(start/width)%breakerBuckets]
+	if bucket.start != start {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// counts sums the buckets still inside the window.
+func (b *CircuitBreaker) counts(now time.Time) (total, failures, slow int) {
+	oldest := now.Add(-b.Window).UnixNano()
+	for _, bucket := range b.buckets {
+		if bucket.start > oldest {
+			total += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return total, failures, slow
+}
@@ -7,18 +7,18 @@ import (
 	"net/http"
 )
 
-func MakeL7StaticTestServers() []*L7BackendServer {
-	var servers []*L7BackendServer
+func MakeL7StaticTestServers() []*Server {
+	var servers []*Server
 
 	weights := []int{5, 3, 1} // Highly skewed weights
 
 	for i := 0; i < 3; i++ {
 		addr := fmt.Sprintf(":800%d", i)
-		opts := L7ServerOpts{
+		opts := ServerOpts{
 			Address: addr,
 			Weight:  weights[i],
 		}
-		server := NewL7Server(opts)
+		server := NewServer(opts)
 		log.Printf("[L7_TEST_SERVER] Creating static test server at %s with weight %d", addr, weights[i])
 		go server.testStaticServerListener()
 		servers = append(servers, server)
@@ -27,7 +27,7 @@ func MakeL7StaticTestServers() []*L7BackendServer {
 	return servers
 }
 
-func (s *L7BackendServer) testStaticServerListener() {
+func (s *Server) testStaticServerListener() {
 	//fs := http.FileServer(http.Dir("./static"))
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -51,18 +51,18 @@ func (s *L7BackendServer) testStaticServerListener() {
 	}
 }
 
-func MakeL7DynamicTestServers() []*L7BackendServer {
-	var servers []*L7BackendServer
+func MakeL7DynamicTestServers() []*Server {
+	var servers []*Server
 
 	weights := []int{5, 3, 1} // Highly skewed weights
 
 	for i := 0; i < 3; i++ {
 		addr := fmt.Sprintf(":801%d", i)
-		opts := L7ServerOpts{
+		opts := ServerOpts{
 			Address: addr,
 			Weight:  weights[i],
 		}
-		server := NewL7Server(opts)
+		server := NewServer(opts)
 		log.Printf("[L7_TEST_SERVER] Creating dynamic test server at %s with weight %d", addr, weights[i])
 		go server.testDynamicServerListener()
 		servers = append(servers, server)
@@ -71,13 +71,19 @@ func MakeL7DynamicTestServers() []*L7BackendServer {
 	return servers
 }
 
-func (s *L7BackendServer) testDynamicServerListener() {
+func (s *Server) testDynamicServerListener() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", dynamicHandlerFunc)
 
+	// Also accept h2c so the pool can be proxied over HTTP/2
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
 	server := &http.Server{
-		Addr:    s.Address,
-		Handler: mux,
+		Addr:      s.Address,
+		Handler:   mux,
+		Protocols: protocols,
 	}
 
 	log.Printf("[L7_TEST_SERVER] Dynamic server starting on %s", s.Address)
@@ -95,6 +101,7 @@ func dynamicHandlerFunc(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{
 		"path":   r.URL.Path,
 		"method": r.Method,
+		"proto":  r.Proto,
 		"msg":    "Handled by API server",
 	}
 
@@ -7,18 +7,18 @@ import (
 	"net"
 )
 
-func MakeL4TestServers() []*L4BackendServer {
-	var servers []*L4BackendServer
+func MakeL4TestServers() []*Server {
+	var servers []*Server
 
 	weights := []int{5, 3, 1} // Highly skewed weights
 
 	for i := 0; i < 3; i++ {
 		addr := fmt.Sprintf(":900%d", i)
-		opts := L4ServerOpts{
+		opts := ServerOpts{
 			Address: addr,
 			Weight:  weights[i],
 		}
-		server := NewL4Server(opts)
+		server := NewServer(opts)
 		server.testServerListener()
 		servers = append(servers, server)
 	}
@@ -26,7 +26,7 @@ func MakeL4TestServers() []*L4BackendServer {
 	return servers
 }
 
-func (bs *L4BackendServer) testServerListener() {
+func (bs *Server) testServerListener() {
 	listener, err := net.Listen("tcp", bs.Address)
 	if err != nil {
 		log.Printf("Error listening from server %s: %v", bs.Address, err)
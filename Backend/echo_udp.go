@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"net"
+)
+
+func MakeUDPTestServers() []*Server {
+	var servers []*Server
+
+	for i := 0; i < 3; i++ {
+		addr := fmt.Sprintf("127.0.0.1:910%d", i)
+		opts := ServerOpts{
+			Address: addr,
+			Weight:  1,
+		}
+		server := NewServer(opts)
+		server.testUDPServerListener()
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+func (bs *Server) testUDPServerListener() {
+	addr, err := net.ResolveUDPAddr("udp", bs.Address)
+	if err != nil {
+		log.Printf("Error resolving UDP address %s: %v", bs.Address, err)
+		return
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Printf("Error listening from UDP server %s: %v", bs.Address, err)
+		return
+	}
+
+	log.Printf("UDP backend server started on %s", bs.Address)
+
+	go func() {
+		buff := make([]byte, 1024)
+
+		for {
+			n, client, err := conn.ReadFromUDP(buff)
+			if err != nil {
+				log.Printf("Error reading on UDP server %s: %v", bs.Address, err)
+				return
+			}
+
+			log.Printf("Received (%d) bytes from Load Balancer on UDP %s", n, bs.Address)
+
+			msg := fmt.Sprintf("Hello from UDP backend %s\n", bs.Address)
+			if _, err := conn.WriteToUDP([]byte(msg), client); err != nil {
+				log.Printf("Error writing to Load Balancer: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// grpc.health.v1.HealthCheckResponse.ServingStatus
+const grpcServing = 1
+
+// grpcHealthCheck calls grpc.health.v1.Health/Check over HTTP/2 (h2 when the
+// server has TLS, h2c otherwise). The messages are tiny, so they are encoded
+// by hand rather than pulling in a protobuf dependency.
+func grpcHealthCheck(s *Server, opts HealthCheckOpts) error {
+	protocols := new(http.Protocols)
+	scheme := "http"
+	if s.TLS != nil {
+		scheme = "https"
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: s.TLS,
+		Protocols:       protocols,
+	}
+	defer transport.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("%s://%s/grpc.health.v1.Health/Check", scheme, s.HostPort())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(grpcFrame(healthCheckRequest(opts.Service))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status") // Trailers-only response
+	}
+	if status != "0" {
+		return fmt.Errorf("grpc-status %s: %s", status, resp.Trailer.Get("Grpc-Message"))
+	}
+
+	serving, err := parseHealthCheckResponse(body)
+	if err != nil {
+		return err
+	}
+	if serving != grpcServing {
+		return fmt.Errorf("serving status %d", serving)
+	}
+	return nil
+}
+
+// healthCheckRequest encodes HealthCheckRequest{service: service}.
+func healthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	msg := []byte{0x0a} // Field 1, length-delimited
+	msg = binary.AppendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// grpcFrame prefixes msg with the uncompressed gRPC length-prefixed framing.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// parseHealthCheckResponse extracts HealthCheckResponse.status (field 1,
+// varint) from a single gRPC frame.
+func parseHealthCheckResponse(body []byte) (uint64, error) {
+	if len(body) < 5 || body[0] != 0 {
+		return 0, errors.New("malformed or compressed gRPC response")
+	}
+
+	length := binary.BigEndian.Uint32(body[1:5])
+	msg := body[5:]
+	if uint32(len(msg)) < length {
+		return 0, errors.New("truncated gRPC response")
+	}
+	msg = msg[:length]
+
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed health check response")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // Varint
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed health check response")
+			}
+			if key>>3 == 1 {
+				return value, nil
+			}
+			msg = msg[n:]
+		case 2: // Length-delimited, skip
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return 0, errors.New("malformed health check response")
+			}
+			msg = msg[n+int(size):]
+		default:
+			return 0, fmt.Errorf("unexpected wire type %d", key&7)
+		}
+	}
+
+	// Status omitted on the wire means UNKNOWN (0)
+	return 0, nil
+}
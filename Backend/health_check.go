@@ -1,32 +1,123 @@
 package backend
 
 import (
+	"fmt"
 	"log"
-	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
-func (pool *L4BackendPool) HealthChecker() {
-	for {
+type HealthCheckType string
+
+const (
+	HealthCheckTCP  HealthCheckType = "tcp"
+	HealthCheckHTTP HealthCheckType = "http"
+	HealthCheckGRPC HealthCheckType = "grpc" // grpc.health.v1.Health/Check
+)
+
+type HealthCheckOpts struct {
+	Type     HealthCheckType // Defaults to tcp
+	Path     string          // Request path for http checks, defaults to "/"
+	Service  string          // Service name for grpc checks, empty checks the whole server
+	Interval time.Duration   // Defaults to 3s
+	Timeout  time.Duration   // Defaults to 2s
+}
+
+// HealthCheckFunc probes a single server and returns an error if it is unhealthy.
+type HealthCheckFunc func(s *Server, opts HealthCheckOpts) error
+
+var (
+	healthChecksMu sync.RWMutex
+	healthChecks   = map[HealthCheckType]HealthCheckFunc{
+		HealthCheckTCP:  tcpHealthCheck,
+		HealthCheckHTTP: httpHealthCheck,
+		HealthCheckGRPC: grpcHealthCheck,
+	}
+)
+
+// RegisterHealthCheck makes a health check type available to pools.
+func RegisterHealthCheck(checkType HealthCheckType, check HealthCheckFunc) {
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+	healthChecks[checkType] = check
+}
+
+func (opts HealthCheckOpts) withDefaults() HealthCheckOpts {
+	if opts.Type == "" {
+		opts.Type = HealthCheckTCP
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 3 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	return opts
+}
 
-		pool.Mutex.Lock()
+// HealthChecker probes every server in the current snapshot. No pool lock is
+// held while probing, so selection is never blocked on a slow backend.
+func (pool *Pool) HealthChecker() {
+	opts := pool.HealthCheck.withDefaults()
 
-		for _, s := range pool.Servers {
-			conn, err := net.DialTimeout("tcp", s.Address, 2*time.Second)
-			if err != nil {
-				s.Alive = false
-				s.LastChecked = time.Now()
-				log.Printf("[HealthCheck] %s is down, timestamp %s", s.Address, time.Now())
+	healthChecksMu.RLock()
+	check, exists := healthChecks[opts.Type]
+	healthChecksMu.RUnlock()
+
+	if !exists {
+		log.Printf("[HealthCheck] Pool %s: unknown health check type %q", pool.Name, opts.Type)
+		return
+	}
+
+	for {
+		for _, s := range pool.Snapshot().Servers {
+			if err := check(s, opts); err != nil {
+				s.SetHealth(false, time.Now())
+				log.Printf("[HealthCheck] %s is down (%v), timestamp %s", s.Address, err, time.Now())
 			} else {
-				s.Alive = true
-				s.LastChecked = time.Now()
+				s.SetHealth(true, time.Now())
 				log.Printf("[HealthCheck] %s is up and running, timestamp %s", s.Address, time.Now())
-				conn.Close()
 			}
-
 		}
 
-		pool.Mutex.Unlock()
-		time.Sleep(3 * time.Second)
+		time.Sleep(opts.Interval)
+	}
+}
+
+func tcpHealthCheck(s *Server, opts HealthCheckOpts) error {
+	conn, err := s.Dial(opts.Timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func httpHealthCheck(s *Server, opts HealthCheckOpts) error {
+	scheme := "http"
+	transport := &http.Transport{}
+	if s.TLS != nil {
+		scheme = "https"
+		transport.TLSClientConfig = s.TLS
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%s://%s%s", scheme, s.HostPort(), opts.Path))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
 	}
+	return nil
 }
@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type PoolOpts struct {
+	Name            string
+	Servers         []*Server
+	SlowStart       SlowStartOpts
+	HealthCheck     HealthCheckOpts
+	Algorithm       string         // Registered strategy name, round robin if empty
+	AlgorithmParams map[string]any // Parameters declared by the strategy
+	HTTP2           bool           // L7 speaks HTTP/2 upstream: h2 with TLS, h2c otherwise
+	Queue           QueueOpts
+	RateLimit       RateLimitOpts // L4 connections and L7 requests sent to the pool
+	CircuitBreaker  CircuitBreakerOpts
+}
+
+// QueueOpts lets connections wait for a server to drop below MaxConns instead
+// of failing straight away when every healthy server is full.
+type QueueOpts struct {
+	Size    int           // Maximum number of waiters, queueing is off if zero
+	Timeout time.Duration // How long a waiter waits for a slot, defaults to 5s
+}
+
+// PoolSnapshot is an immutable view of a pool published to the selection path.
+// A new snapshot replaces it whenever membership changes.
+type PoolSnapshot struct {
+	Servers   []*Server
+	SlowStart SlowStartOpts
+}
+
+// Pool is a named group of servers, used by both L4 listeners and L7 routes.
+type Pool struct {
+	PoolOpts
+	Mutex    sync.Mutex   // Serialises writers, readers use Snapshot
+	Limiter  *RateLimiter // Nil if the pool is not rate limited
+	snapshot atomic.Pointer[PoolSnapshot]
+}
+
+func NewPool(Opts PoolOpts) *Pool {
+	pool := &Pool{
+		PoolOpts: Opts,
+		Limiter:  NewRateLimiter(Opts.RateLimit),
+	}
+	for _, s := range pool.Servers {
+		s.Breaker = NewCircuitBreaker(s.Address, Opts.CircuitBreaker)
+	}
+	pool.publish()
+	return pool
+}
+
+// Snapshot returns the current servers without taking a lock.
+func (pool *Pool) Snapshot() *PoolSnapshot {
+	if snap := pool.snapshot.Load(); snap != nil {
+		return snap
+	}
+
+	// Pool was built without NewPool
+	pool.Mutex.Lock()
+	defer pool.Mutex.Unlock()
+	if snap := pool.snapshot.Load(); snap != nil {
+		return snap
+	}
+	return pool.publish()
+}
+
+// publish must be called with Mutex held or before the pool is shared.
+func (pool *Pool) publish() *PoolSnapshot {
+	snap := &PoolSnapshot{
+		Servers:   append([]*Server(nil), pool.Servers...),
+		SlowStart: pool.SlowStart,
+	}
+	pool.snapshot.Store(snap)
+	return snap
+}
+
+// AddServer adds a server to the pool, starting its slow-start ramp.
+func (pool *Pool) AddServer(s *Server) {
+	pool.Mutex.Lock()
+	defer pool.Mutex.Unlock()
+
+	s.HealthySince.Store(time.Now().UnixNano())
+	s.Breaker = NewCircuitBreaker(s.Address, pool.CircuitBreaker)
+	pool.Servers = append(pool.Servers, s)
+	pool.publish()
+}
+
+// RemoveServer takes the server at address out of the pool and returns it, or
+// nil if there is none. Connections and requests already on it are left to
+// finish; Drain it first to let them wind down.
+func (pool *Pool) RemoveServer(address string) *Server {
+	pool.Mutex.Lock()
+	defer pool.Mutex.Unlock()
+
+	for i, s := range pool.Servers {
+		if s.Address == address {
+			pool.Servers = append(pool.Servers[:i:i], pool.Servers[i+1:]...)
+			pool.publish()
+			return s
+		}
+	}
+	return nil
+}
+
+// Drain stops new connections and requests going to the server at address.
+// Existing ones are left to finish. It reports whether the server was found.
+func (pool *Pool) Drain(address string) bool {
+	for _, s := range pool.Snapshot().Servers {
+		if s.Address == address {
+			s.Draining.Store(true)
+			return true
+		}
+	}
+	return false
+}
+
+// Undrain returns a drained server to selection.
+func (pool *Pool) Undrain(address string) bool {
+	for _, s := range pool.Snapshot().Servers {
+		if s.Address == address {
+			s.Draining.Store(false)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitKey selects what a rate limit counts against.
+type RateLimitKey string
+
+const (
+	RateLimitByIP     RateLimitKey = "ip"     // Client IP, the default
+	RateLimitByHeader RateLimitKey = "header" // Value of RateLimitOpts.Header, the client IP if absent
+	RateLimitByRoute  RateLimitKey = "route"  // L7 route name, shared by all clients of a route
+)
+
+// RateLimitOpts configures a token bucket per key. A zero Rate disables it.
+// Connections (L4) and requests (L7) each take one token.
+type RateLimitOpts struct {
+	Rate   float64 // Tokens added per second
+	Burst  int     // Bucket size, defaults to Rate rounded up
+	Key    RateLimitKey
+	Header string
+}
+
+// pruneInterval is how often buckets that have refilled are dropped, so keys
+// that stop sending do not hold memory.
+const pruneInterval = time.Minute
+
+// RateLimiter holds one token bucket per key.
+type RateLimiter struct {
+	RateLimitOpts
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter for opts, or nil if opts.Rate is zero. A nil
+// limiter allows everything.
+func NewRateLimiter(opts RateLimitOpts) *RateLimiter {
+	if opts.Rate <= 0 {
+		return nil
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = int(math.Ceil(opts.Rate))
+	}
+	if opts.Key == "" {
+		opts.Key = RateLimitByIP
+	}
+
+	return &RateLimiter{
+		RateLimitOpts: opts,
+		buckets:       make(map[string]*tokenBucket),
+		lastPrune:     time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty it returns false
+// and how long until a token is available.
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *RateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.Rate
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// prune drops full buckets, which behave the same as missing ones.
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
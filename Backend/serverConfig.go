@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type ServerOpts struct {
+	Address string
+	Weight  int
+	Labels  map[string]string // Free-form metadata, e.g. zone or version
+	TLS     *tls.Config       // Upstream TLS, plaintext if nil
+	// MaxConns caps active connections (L4) or in-flight requests (L7),
+	// unlimited if zero. A full server is skipped by every strategy.
+	MaxConns int
+}
+
+// Server is a backend shared by the L4 and L7 paths. The fields are atomics so
+// the selection path can read them without locks.
+type Server struct {
+	ServerOpts
+	ConnCount atomic.Int64 // Active connections (L4) or in-flight requests (L7)
+	//AvgLatency    float64 // For Least Response Time
+	Alive         atomic.Bool     // Health check status
+	Draining      atomic.Bool     // Finishing existing work, receives nothing new
+	LastChecked   atomic.Int64    // Unix nanoseconds of the last health check
+	HealthySince  atomic.Int64    // Unix nanoseconds the slow-start ramp began, zero if not ramping
+	StickyClients map[string]bool // Optional: for session stickiness
+	Breaker       *CircuitBreaker // Set by the pool, nil if it has no circuit breaker
+}
+
+func NewServer(Opts ServerOpts) *Server {
+	s := &Server{
+		ServerOpts:    Opts,
+		StickyClients: make(map[string]bool),
+	}
+	s.Alive.Store(true)
+	return s
+}
+
+// IsAlive reports whether the server may be selected: healthy, not draining,
+// below MaxConns and not cut off by its circuit breaker.
+func (s *Server) IsAlive() bool              { return s.IsHealthy() && !s.Full() && s.Breaker.Allows() }
+func (s *Server) IsHealthy() bool            { return s.Alive.Load() && !s.Draining.Load() }
+func (s *Server) Full() bool                 { return s.MaxConns > 0 && s.GetConnCount() >= s.MaxConns }
+func (s *Server) GetConnCount() int          { return int(s.ConnCount.Load()) }
+func (s *Server) AddConnCount(delta int) int { return int(s.ConnCount.Add(int64(delta))) }
+func (s *Server) GetWeight() int             { return s.Weight }
+func (s *Server) GetAddress() string         { return s.Address }
+func (s *Server) GetLastChecked() time.Time  { return unixNanoTime(s.LastChecked.Load()) }
+func (s *Server) GetHealthySince() time.Time { return unixNanoTime(s.HealthySince.Load()) }
+
+// TryAcquire counts a new connection against the server unless that would
+// exceed MaxConns or its half-open circuit breaker has no probe slot left.
+// Selection only sees a snapshot of both, so callers reserve with TryAcquire
+// and pick again if it fails.
+func (s *Server) TryAcquire() bool {
+	if !s.reserveConn() {
+		return false
+	}
+	if !s.Breaker.admit() {
+		s.ConnCount.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (s *Server) reserveConn() bool {
+	if s.MaxConns <= 0 {
+		s.ConnCount.Add(1)
+		return true
+	}
+
+	for {
+		current := s.ConnCount.Load()
+		if current >= int64(s.MaxConns) {
+			return false
+		}
+		if s.ConnCount.CompareAndSwap(current, current+1) {
+			return true
+		}
+	}
+}
+
+// Report records the outcome of a connection or request on the server's
+// circuit breaker. latency is the time to connect or to the response headers.
+func (s *Server) Report(ok bool, latency time.Duration) {
+	s.Breaker.Record(ok, latency)
+}
+
+// SetHealth records a health check result, starting the slow-start ramp when a
+// dead server comes back.
+func (s *Server) SetHealth(alive bool, now time.Time) {
+	s.LastChecked.Store(now.UnixNano())
+	if alive && !s.Alive.Swap(true) {
+		s.HealthySince.Store(now.UnixNano())
+	} else if !alive {
+		s.Alive.Store(false)
+	}
+}
+
+// Dial opens a connection to the server, wrapped in TLS when the server is
+// configured for it. A zero timeout means no timeout.
+func (s *Server) Dial(timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if s.TLS != nil {
+		return tls.DialWithDialer(dialer, "tcp", s.Address, s.TLS)
+	}
+	return dialer.Dial("tcp", s.Address)
+}
+
+// HostPort returns the address in a form usable in a URL, turning a
+// listen-style address such as ":8000" into "localhost:8000".
+func (s *Server) HostPort() string {
+	if strings.HasPrefix(s.Address, ":") {
+		return "localhost" + s.Address
+	}
+	return s.Address
+}
+
+func unixNanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,44 @@
+package backend
+
+import (
+	"math"
+	"time"
+)
+
+// SlowStartOpts configures how a pool ramps traffic onto a server that has just
+// been added or has just recovered. A zero Window disables slow start.
+type SlowStartOpts struct {
+	Window time.Duration
+	// MinWeightPercent is the share of the configured weight a server gets at
+	// the start of the window (defaults to 10).
+	MinWeightPercent int
+	// Aggression shapes the ramp: 1 (the default) is linear, larger values
+	// hand out traffic sooner, smaller values hold it back longer.
+	Aggression float64
+}
+
+// Factor returns the fraction of its configured weight a server that became
+// healthy at since should receive now, in the range (0, 1].
+func (o SlowStartOpts) Factor(since time.Time, now time.Time) float64 {
+	if o.Window <= 0 || since.IsZero() {
+		return 1
+	}
+
+	elapsed := now.Sub(since)
+	if elapsed >= o.Window {
+		return 1
+	}
+
+	minFactor := 0.1
+	if o.MinWeightPercent > 0 {
+		minFactor = math.Min(float64(o.MinWeightPercent)/100, 1)
+	}
+
+	aggression := o.Aggression
+	if aggression <= 0 {
+		aggression = 1
+	}
+
+	progress := math.Max(float64(elapsed)/float64(o.Window), 0)
+	return math.Max(math.Pow(progress, 1/aggression), minFactor)
+}
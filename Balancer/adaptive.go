@@ -0,0 +1,78 @@
+package balancer
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+const defaultImbalanceHigh = 5
+
+// AdaptiveOpts tunes AlgoAdaptive.
+type AdaptiveOpts struct {
+	// ImbalanceHigh is the spread in connections between the busiest and
+	// idlest server at which the pool switches to least connection
+	// (defaults to 5).
+	ImbalanceHigh int
+	// ImbalanceLow is the spread at which it switches back to round robin
+	// (defaults to ImbalanceHigh/2). Keeping it below ImbalanceHigh stops the
+	// strategy from flipping on every connection near the threshold.
+	ImbalanceLow int
+}
+
+// Adaptive strategy: round robin while the pool is balanced, least connection
+// once the load spread crosses ImbalanceHigh, and back to round robin only
+// after it falls to ImbalanceLow. The weighted variants are used when the pool
+// has uneven weights.
+type AlgoAdaptive struct {
+	opts       AdaptiveOpts
+	imbalanced atomic.Bool
+
+	rr, wrr, lc, wlc LBStrategy
+}
+
+func NewAdaptiveAlgo(opts AdaptiveOpts) LBStrategy {
+	if opts.ImbalanceHigh <= 0 {
+		opts.ImbalanceHigh = defaultImbalanceHigh
+	}
+	if opts.ImbalanceLow <= 0 || opts.ImbalanceLow > opts.ImbalanceHigh {
+		opts.ImbalanceLow = opts.ImbalanceHigh / 2
+	}
+
+	return &AlgoAdaptive{
+		opts: opts,
+		rr:   NewRRAlgo(),
+		wrr:  NewWRRAlgo(),
+		lc:   NewLCountAlgo(),
+		wlc:  NewWLCountAlgo(),
+	}
+}
+
+func (a *AlgoAdaptive) ImplementAlgo(pool ServerPool) Server {
+	spread := LoadSpread(pool)
+	weighted := HasUnevenWeights(pool)
+
+	imbalanced := a.imbalanced.Load()
+	switch {
+	case !imbalanced && spread >= a.opts.ImbalanceHigh:
+		if a.imbalanced.CompareAndSwap(false, true) {
+			log.Printf("Adaptive: Load spread %d reached %d, switching to least connection", spread, a.opts.ImbalanceHigh)
+		}
+		imbalanced = true
+	case imbalanced && spread <= a.opts.ImbalanceLow:
+		if a.imbalanced.CompareAndSwap(true, false) {
+			log.Printf("Adaptive: Load spread %d fell to %d, switching to round robin", spread, a.opts.ImbalanceLow)
+		}
+		imbalanced = false
+	}
+
+	switch {
+	case imbalanced && weighted:
+		return a.wlc.ImplementAlgo(pool)
+	case imbalanced:
+		return a.lc.ImplementAlgo(pool)
+	case weighted:
+		return a.wrr.ImplementAlgo(pool)
+	default:
+		return a.rr.ImplementAlgo(pool)
+	}
+}
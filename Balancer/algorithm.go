@@ -2,15 +2,18 @@ package balancer
 
 import (
 	"fmt"
-	"hash/fnv"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	backend "github.com/Faizan2005/Backend"
 )
 
-// Interface for selecting lb algorithm for different situations
+// Interface for selecting lb algorithm for different situations.
+// Implementations are called concurrently and must not allocate or log on the
+// success path; they only read the pool through its snapshot.
 type LBStrategy interface {
 	ImplementAlgo(pool ServerPool) Server
 }
@@ -18,114 +21,84 @@ type LBStrategy interface {
 type Server interface {
 	IsAlive() bool
 	GetConnCount() int
-	SetConnCount(int)
+	AddConnCount(delta int) int
 	GetWeight() int
-	Lock()
-	Unlock()
 	GetAddress() string
 	GetLastChecked() time.Time
+	GetHealthySince() time.Time
 }
 
-type ServerPool interface {
-	GetServers() []Server
-	GetServer(int) Server
-	GetIndex() int
-	SetIndex(int)
-	Lock()
-	Unlock()
-}
-
-type L4ServerAdapter struct {
-	*backend.L4BackendServer
+// Snapshot is an immutable view of a pool's servers. Strategies must not
+// modify it; pools publish a new one when membership changes.
+type Snapshot struct {
+	Servers   []Server
+	SlowStart backend.SlowStartOpts
 }
 
-func (s *L4ServerAdapter) IsAlive() bool              { return s.Alive }
-func (s *L4ServerAdapter) GetConnCount() int          { return s.ConnCount }
-func (s *L4ServerAdapter) SetConnCount(connCount int) { s.ConnCount = connCount }
-func (s *L4ServerAdapter) GetWeight() int             { return s.Weight }
-func (s *L4ServerAdapter) GetAddress() string         { return s.Address }
-func (s *L4ServerAdapter) GetLastChecked() time.Time  { return s.LastChecked }
-func (s *L4ServerAdapter) Lock()                      { s.Mx.Lock() }
-func (s *L4ServerAdapter) Unlock()                    { s.Mx.Unlock() }
-
-type L4PoolAdapter struct {
-	*backend.L4BackendPool
+type ServerPool interface {
+	Snapshot() *Snapshot
 }
 
-func (p *L4PoolAdapter) GetServers() []Server {
-	servers := []Server{}
-	for _, s := range p.Servers {
-		servers = append(servers, &L4ServerAdapter{s})
-	}
-	return servers
+// PoolAdapter exposes a backend pool to strategies. It remembers which backend
+// snapshot its Snapshot was built from, so it only rebuilds (and allocates)
+// when the pool publishes a new one. It must be created once per pool and not
+// copied.
+type PoolAdapter struct {
+	*backend.Pool
+	cache atomic.Pointer[cachedSnapshot]
 }
 
-func (p *L4PoolAdapter) GetServer(index int) Server {
-	s := p.Servers[index]
-	return &L4ServerAdapter{s}
+type cachedSnapshot struct {
+	source   *backend.PoolSnapshot
+	snapshot *Snapshot
 }
 
-func (p *L4PoolAdapter) GetIndex() int      { return p.Index }
-func (p *L4PoolAdapter) SetIndex(index int) { p.Index = index }
-func (p *L4PoolAdapter) Lock()              { p.Mutex.RLock() }
-func (p *L4PoolAdapter) Unlock()            { p.Mutex.RUnlock() }
-
-type L7ServerAdapter struct {
-	*backend.L7BackendServer
+func NewPoolAdapter(pool *backend.Pool) *PoolAdapter {
+	return &PoolAdapter{Pool: pool}
 }
 
-func (s *L7ServerAdapter) IsAlive() bool             { return s.Alive }
-func (s *L7ServerAdapter) GetConnCount() int         { return s.ReqCount }
-func (s *L7ServerAdapter) SetConnCount(reqCount int) { s.ReqCount = reqCount }
-func (s *L7ServerAdapter) GetWeight() int            { return s.Weight }
-func (s *L7ServerAdapter) GetAddress() string        { return s.Address }
-func (s *L7ServerAdapter) GetLastChecked() time.Time { return s.LastChecked }
-func (s *L7ServerAdapter) Lock()                     { s.Mx.Lock() }
-func (s *L7ServerAdapter) Unlock()                   { s.Mx.Unlock() }
-
-type L7PoolAdapter struct {
-	*backend.L7ServerPool
-}
+func (p *PoolAdapter) Snapshot() *Snapshot {
+	source := p.Pool.Snapshot()
+	if c := p.cache.Load(); c != nil && c.source == source {
+		return c.snapshot
+	}
 
-func (p *L7PoolAdapter) GetServers() []Server {
-	servers := []Server{}
-	for _, s := range p.Servers {
-		servers = append(servers, &L7ServerAdapter{s})
+	snap := &Snapshot{
+		Servers:   make([]Server, len(source.Servers)),
+		SlowStart: source.SlowStart,
+	}
+	for i, s := range source.Servers {
+		snap.Servers[i] = s
 	}
-	return servers
-}
 
-func (p *L7PoolAdapter) GetServer(index int) Server {
-	s := p.Servers[index]
-	return &L7ServerAdapter{s}
+	p.cache.Store(&cachedSnapshot{source: source, snapshot: snap})
+	return snap
 }
 
-func (p *L7PoolAdapter) GetIndex() int      { return p.Index }
-func (p *L7PoolAdapter) SetIndex(index int) { p.Index = index }
-func (p *L7PoolAdapter) Lock()              { p.Mutex.RLock() }
-func (p *L7PoolAdapter) Unlock()            { p.Mutex.RUnlock() }
-
 // Implementing RR algo
-type AlgoRR struct{}
+type AlgoRR struct {
+	next atomic.Uint64
+}
 
 func (rr *AlgoRR) ImplementAlgo(pool ServerPool) Server {
-	pool.Lock()
-	defer pool.Unlock()
-
-	servers := pool.GetServers()
-	n := len(servers)
-	startIndex := pool.GetIndex()
-
-	log.Printf("Round Robin: Starting selection from index %d", startIndex)
-
-	for i := 0; i < n; i++ {
-		index := (startIndex + i) % n
-		server := pool.GetServer(index)
+	servers := pool.Snapshot().Servers
+	n := uint64(len(servers))
+	if n == 0 {
+		log.Println("Round Robin: Pool is empty")
+		return nil
+	}
 
-		if server != nil && server.IsAlive() {
-			log.Printf("Round Robin: Selected server %s at index %d", server.GetAddress(), index)
-			pool.SetIndex((index + 1) % n) // Wrap around
-			return server
+	start := rr.next.Add(1) - 1
+
+	for i := uint64(0); i < n; i++ {
+		index := (start + i) % n
+		if servers[index].IsAlive() {
+			if i > 0 {
+				// Skip past the dead servers so the next pick does not
+				// land on the same healthy server again.
+				rr.next.CompareAndSwap(start+1, start+i+1)
+			}
+			return servers[index]
 		}
 	}
 
@@ -133,118 +106,106 @@ func (rr *AlgoRR) ImplementAlgo(pool ServerPool) Server {
 	return nil
 }
 
+// Smooth weighted round robin (as in nginx). Every pick adds each healthy
+// server's weight to its current weight, selects the highest current weight and
+// subtracts the total from it, so picks interleave in proportion to weight
+// (a, b, a, c, a, b, a, ... for 5/3/1) instead of arriving in bursts.
+// The current weights are inherently shared state, so they stay behind a
+// mutex owned by the strategy rather than the pool. They are kept by position
+// in the snapshot and only remapped when the pool publishes a new one.
 type AlgoWRR struct {
-	counter int
+	mu      sync.Mutex
+	snap    *Snapshot // Snapshot current is indexed by
+	current []int     // Current weight per server in snap
 }
 
 func (wrr *AlgoWRR) ImplementAlgo(pool ServerPool) Server {
-	pool.Lock()
-	defer pool.Unlock()
+	snap := pool.Snapshot()
+	now := time.Now()
+
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
 
+	if snap != wrr.snap {
+		wrr.remap(snap)
+	}
+
+	selected := -1
 	total := 0
-	for _, s := range pool.GetServers() {
-		if s.IsAlive() {
-			total += s.GetWeight()
+	for i, s := range snap.Servers {
+		// Unhealthy servers keep their current weight so the rotation resumes
+		// where it left off when they come back.
+		weight := snap.effectiveWeight(s, now)
+		if !s.IsAlive() || weight <= 0 {
+			continue
+		}
+
+		wrr.current[i] += weight
+		total += weight
+
+		if selected < 0 || wrr.current[i] > wrr.current[selected] {
+			selected = i
 		}
 	}
 
-	if total == 0 {
+	if selected < 0 {
 		log.Println("Weighted Round Robin: No healthy servers available")
-		return nil // No healthy servers
+		return nil
 	}
 
-	wrr.counter = (wrr.counter + 1) % total
-	log.Printf("Weighted Round Robin: Current counter value is %d", wrr.counter)
+	wrr.current[selected] -= total
+	return snap.Servers[selected]
+}
 
-	sum := 0
-	for _, s := range pool.GetServers() {
-		if !s.IsAlive() {
-			continue
-		}
-		sum += s.GetWeight()
-		if wrr.counter < sum {
-			log.Printf("Weighted Round Robin: Selected server %s with weight %d", s.GetAddress(), s.GetWeight())
-			return s
+// remap carries current weights over to a new snapshot by server address;
+// servers that left the pool are dropped and new ones start at zero.
+func (wrr *AlgoWRR) remap(snap *Snapshot) {
+	previous := make(map[string]int, len(wrr.current))
+	if wrr.snap != nil {
+		for i, s := range wrr.snap.Servers {
+			previous[s.GetAddress()] = wrr.current[i]
 		}
 	}
 
-	log.Println("Weighted Round Robin: No server selected")
-	return nil
+	wrr.current = make([]int, len(snap.Servers))
+	for i, s := range snap.Servers {
+		wrr.current[i] = previous[s.GetAddress()]
+	}
+	wrr.snap = snap
 }
 
 type AlgoLeastConn struct{}
 
 func (lc *AlgoLeastConn) ImplementAlgo(pool ServerPool) Server {
-	pool.Lock()
-	defer pool.Unlock()
+	var selected Server
+	minConns := 0
 
-	selected := new(Server)
-	minConns := int(^uint(0) >> 1) // Max int
-
-	log.Println("Least Connections: Evaluating servers for least connections")
+	for _, s := range pool.Snapshot().Servers {
+		if !s.IsAlive() {
+			continue
+		}
 
-	for _, s := range pool.GetServers() {
-		s.Lock()
 		cCount := s.GetConnCount()
-		s.Unlock()
-
-		log.Printf("Least Connections: Server %s has %d connections", s.GetAddress(), cCount)
-
 		if selected == nil || cCount < minConns {
-			selected = &s
+			selected = s
 			minConns = cCount
-			log.Printf("Least Connections: New selected server %s with %d connections", s.GetAddress(), cCount)
-		}
-	}
-
-	if selected != nil {
-		log.Printf("Least Connections: Selected server %s with %d connections", (*selected).GetAddress(), minConns)
-		return *selected
-	}
-
-	log.Println("Least Connections: No server selected")
-	return nil
-}
-
-func SelectAlgoL4(pool ServerPool) string {
-	if HasUnevenWeights(pool) {
-		return "weighted_least_connection"
-	}
-	return "least_connection"
-}
-
-func SelectAlgoL7(pool ServerPool) string {
-	if HasLoadImbalance(pool) {
-		if HasUnevenWeights(pool) {
-			return "weighted_least_connection"
 		}
-		return "least_connection"
 	}
 
-	if HasUnevenWeights(pool) {
-		return "weighted_round_robin"
+	if selected == nil {
+		log.Println("Least Connections: No server selected")
 	}
-
-	return "round_robin"
+	return selected
 }
 
 func HasUnevenWeights(pool ServerPool) bool {
-	pool.Lock()
-	defer pool.Unlock()
-
-	if len(pool.GetServers()) == 0 {
+	servers := pool.Snapshot().Servers
+	if len(servers) == 0 {
 		return false
 	}
 
-	refServer := pool.GetServer(0)
-	ref := refServer.GetWeight()
-
-	var serverSet = []Server{}
-	for i := 1; i < len(pool.GetServers()); i++ {
-		serverSet = append(serverSet, pool.GetServer(i))
-	}
-
-	for _, s := range serverSet {
+	ref := servers[0].GetWeight()
+	for _, s := range servers[1:] {
 		if s.GetWeight() != ref {
 			return true
 		}
@@ -257,8 +218,7 @@ func NewRRAlgo() LBStrategy {
 }
 
 func NewWRRAlgo() LBStrategy {
-	return &AlgoWRR{
-		counter: 0}
+	return &AlgoWRR{}
 }
 
 func NewLCountAlgo() LBStrategy {
@@ -269,9 +229,23 @@ func NewWLCountAlgo() LBStrategy {
 	return &AlgoWLeastConn{}
 }
 
+func NewP2CAlgo() LBStrategy {
+	return &AlgoP2C{}
+}
+
+func NewRandomAlgo() LBStrategy {
+	return &AlgoRandom{}
+}
+
+func NewWRandomAlgo() LBStrategy {
+	return &AlgoWRandom{}
+}
+
 func IPHash(pool ServerPool, host_ip string) Server {
-	pool.Lock()
-	defer pool.Unlock()
+	servers := pool.Snapshot().Servers
+	if len(servers) == 0 {
+		return nil
+	}
 
 	ip, port, err := net.SplitHostPort(host_ip)
 	if err != nil {
@@ -281,84 +255,62 @@ func IPHash(pool ServerPool, host_ip string) Server {
 
 	fmt.Printf("[IPHash] Client IP: %s, Port: %s\n", ip, port)
 
-	hash := fnv.New32a()
-	hash.Write([]byte(ip))
-	hashValue := hash.Sum32()
-	index := int(hashValue) % len(pool.GetServers())
+	hashValue := fnv32a(ip)
+	index := int(hashValue % uint32(len(servers)))
 
 	fmt.Printf("[IPHash] FNV Hash Value: %d, Backend Index: %d\n", hashValue, index)
-	fmt.Printf("[IPHash] Selected Backend: %s\n", pool.GetServer(index).GetAddress())
+	fmt.Printf("[IPHash] Selected Backend: %s\n", servers[index].GetAddress())
 
-	return pool.GetServer(index)
+	return servers[index]
 }
 
-func HasLoadImbalance(pool ServerPool) bool {
-	pool.Lock()
-	defer pool.Unlock()
+// LoadSpread returns the difference between the most and least loaded healthy
+// servers in the pool.
+func LoadSpread(pool ServerPool) int {
+	max, min, seen := 0, 0, false
 
-	if len(pool.GetServers()) < 2 {
-		return false
-	}
-
-	max, min := pool.GetServer(0).GetConnCount(), pool.GetServer(0).GetConnCount()
-
-	for _, s := range pool.GetServers() {
-		if s.GetConnCount() > max {
-			max = s.GetConnCount()
+	for _, s := range pool.Snapshot().Servers {
+		if !s.IsAlive() {
+			continue
 		}
 
-		if s.GetConnCount() < min {
-			min = s.GetConnCount()
+		count := s.GetConnCount()
+		if !seen || count > max {
+			max = count
 		}
+		if !seen || count < min {
+			min = count
+		}
+		seen = true
 	}
 
-	return max-min >= 5
-}
-
-func ApplyAlgo(pool ServerPool, algoName string, algo map[string]LBStrategy) Server {
-	strategy, exists := algo[algoName]
-	if !exists {
-		log.Printf("Algorithm %s not implemented", algoName)
-	}
-
-	server := strategy.ImplementAlgo(pool)
-	if server != nil {
-		return server // You could support deeper chaining too
-	}
-
-	return nil
+	return max - min
 }
 
 type AlgoWLeastConn struct{}
 
 func (wlc *AlgoWLeastConn) ImplementAlgo(pool ServerPool) Server {
-	pool.Lock()
-	defer pool.Unlock()
-
-	selected := new(Server)
-	minScore := int(^uint(0) >> 1) // Max int
-
-	log.Println("Weighted Least Connections: Evaluating servers for least connections")
+	snap := pool.Snapshot()
+	now := time.Now()
 
-	for _, s := range pool.GetServers() {
-		s.Lock()
-		score := int(s.GetConnCount()) / int(s.GetWeight())
-		s.Unlock()
+	var selected Server
+	selectedConns, selectedWeight := 0, 0
 
-		log.Printf("Weighted Least Connections: Server %s has %d connections", s.GetAddress(), score)
+	for _, s := range snap.Servers {
+		weight := snap.effectiveWeight(s, now)
+		if !s.IsAlive() || weight <= 0 {
+			continue
+		}
 
-		if selected == nil || score < minScore {
-			selected = &s
-			minScore = score
-			log.Printf("Weighted Least Connections: New selected server %s with %d connections", s.GetAddress(), score)
+		cCount := s.GetConnCount()
+		if selected == nil || lessLoaded(cCount, weight, selectedConns, selectedWeight) {
+			selected = s
+			selectedConns, selectedWeight = cCount, weight
 		}
 	}
 
-	if selected != nil {
-		log.Printf("Weighted Least Connections: Selected server %s with %d score", (*selected).GetAddress(), minScore)
-		return *selected
+	if selected == nil {
+		log.Println("Weighted Least Connections: No server selected")
 	}
-
-	log.Println("Weighted Least Connections: No server selected")
-	return nil
+	return selected
 }
@@ -0,0 +1,82 @@
+package balancer
+
+import (
+	"strings"
+	"testing"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+func weightedPool(weights map[string]int) (*backend.Pool, map[string]*backend.Server) {
+	servers := make(map[string]*backend.Server)
+	var list []*backend.Server
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if w, ok := weights[name]; ok {
+			servers[name] = backend.NewServer(backend.ServerOpts{Address: name, Weight: w})
+			list = append(list, servers[name])
+		}
+	}
+	return backend.NewPool(backend.PoolOpts{Name: "test", Servers: list}), servers
+}
+
+func pickSequence(strategy LBStrategy, pool ServerPool, n int) string {
+	var picks strings.Builder
+	for i := 0; i < n; i++ {
+		if s := strategy.ImplementAlgo(pool); s != nil {
+			picks.WriteString(s.GetAddress())
+		} else {
+			picks.WriteString("-")
+		}
+	}
+	return picks.String()
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		dead    []string
+		picks   int
+		want    string
+	}{
+		{"smooth 5/3/1", map[string]int{"a": 5, "b": 3, "c": 1}, nil, 9, "abacababa"},
+		{"equal weights", map[string]int{"a": 1, "b": 1, "c": 1}, nil, 6, "abcabc"},
+		{"dead server skipped", map[string]int{"a": 2, "b": 1, "c": 1}, []string{"a"}, 4, "bcbc"},
+		{"zero weight never picked", map[string]int{"a": 1, "b": 0}, nil, 3, "aaa"},
+		{"nothing alive", map[string]int{"a": 1}, []string{"a"}, 2, "--"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, servers := weightedPool(tt.weights)
+			for _, name := range tt.dead {
+				servers[name].Alive.Store(false)
+			}
+
+			if got := pickSequence(NewWRRAlgo(), NewPoolAdapter(pool), tt.picks); got != tt.want {
+				t.Errorf("picks = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinKeepsRotationAcrossSnapshots(t *testing.T) {
+	pool, _ := weightedPool(map[string]int{"a": 1, "b": 1})
+	adapter := NewPoolAdapter(pool)
+	wrr := NewWRRAlgo()
+
+	if got := pickSequence(wrr, adapter, 1); got != "a" {
+		t.Fatalf("first pick = %s, want a", got)
+	}
+
+	// A new snapshot must not restart the rotation at a.
+	pool.AddServer(backend.NewServer(backend.ServerOpts{Address: "c", Weight: 1}))
+	if got := pickSequence(wrr, adapter, 6); got != "bcabca" {
+		t.Errorf("picks after adding c = %s, want bcabca", got)
+	}
+
+	pool.RemoveServer("b")
+	if got := pickSequence(wrr, adapter, 4); got != "caca" {
+		t.Errorf("picks after removing b = %s, want caca", got)
+	}
+}
@@ -0,0 +1,149 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+const DefaultAlgorithm = "round_robin"
+
+const (
+	defaultQueueTimeout = 5 * time.Second
+	// acquireAttempts bounds how often Acquire picks again after losing a
+	// race for a server's last slot.
+	acquireAttempts = 3
+	// queuePoll makes waiters look again even without a release, as capacity
+	// also appears when servers recover or join the pool.
+	queuePoll = 100 * time.Millisecond
+)
+
+var (
+	ErrNoServer     = errors.New("no healthy server available")
+	ErrQueueFull    = errors.New("all servers are full and the wait queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting for a server below its connection limit")
+)
+
+// Balancer binds a pool to the strategy instance it owns, so round robin
+// indexes and weighted state are never shared between pools.
+type Balancer struct {
+	Pool     *backend.Pool
+	Adapter  *PoolAdapter
+	Strategy LBStrategy
+
+	waiting  atomic.Int64
+	released chan struct{} // Wakes one waiter per released slot
+}
+
+// NewBalancer creates the strategy the pool declares in its options.
+func NewBalancer(pool *backend.Pool) (*Balancer, error) {
+	strategy, err := NewStrategy(pool.Algorithm, pool.AlgorithmParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Balancer{
+		Pool:     pool,
+		Adapter:  NewPoolAdapter(pool),
+		Strategy: strategy,
+		released: make(chan struct{}, max(pool.Queue.Size, 1)),
+	}, nil
+}
+
+// Next selects a server from the pool, or returns nil if none is available.
+func (b *Balancer) Next() *backend.Server {
+	server, _ := b.Strategy.ImplementAlgo(b.Adapter).(*backend.Server)
+	return server
+}
+
+// NextForKey maps key onto the pool's healthy servers with a hash, so the same
+// key keeps reaching the same server while the healthy set is unchanged.
+func (b *Balancer) NextForKey(key string) *backend.Server {
+	server, _ := HashSelect(b.Adapter, key).(*backend.Server)
+	return server
+}
+
+// Acquire selects a server and counts a connection against it, so MaxConns
+// holds under concurrent selection. When every healthy server is full it waits
+// in the pool's queue, if configured, until a slot frees up, the queue timeout
+// passes or ctx ends. The caller must Release the server when done.
+func (b *Balancer) Acquire(ctx context.Context) (*backend.Server, error) {
+	if server := b.tryAcquire(); server != nil {
+		return server, nil
+	}
+	if b.Pool.Queue.Size <= 0 || !b.saturated() {
+		return nil, ErrNoServer
+	}
+
+	if b.waiting.Add(1) > int64(b.Pool.Queue.Size) {
+		b.waiting.Add(-1)
+		return nil, ErrQueueFull
+	}
+	defer b.waiting.Add(-1)
+
+	timeout := b.Pool.Queue.Timeout
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(queuePoll)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-b.released:
+		case <-poll.C:
+		case <-deadline.C:
+			return nil, ErrQueueTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if server := b.tryAcquire(); server != nil {
+			return server, nil
+		}
+	}
+}
+
+// Release gives back a slot taken by Acquire and wakes one waiter.
+func (b *Balancer) Release(server *backend.Server) {
+	server.AddConnCount(-1)
+
+	select {
+	case b.released <- struct{}{}:
+	default:
+	}
+}
+
+// Waiting returns the number of connections queued for a server.
+func (b *Balancer) Waiting() int {
+	return int(b.waiting.Load())
+}
+
+func (b *Balancer) tryAcquire() *backend.Server {
+	for i := 0; i < acquireAttempts; i++ {
+		server := b.Next()
+		if server == nil {
+			return nil
+		}
+		if server.TryAcquire() {
+			return server
+		}
+	}
+	return nil
+}
+
+// saturated reports whether the pool has healthy servers that are only
+// unavailable because they are full, which is worth waiting for.
+func (b *Balancer) saturated() bool {
+	for _, s := range b.Pool.Snapshot().Servers {
+		if s.IsHealthy() && s.Full() {
+			return true
+		}
+	}
+	return false
+}
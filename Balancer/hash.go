@@ -0,0 +1,52 @@
+package balancer
+
+import "log"
+
+// FNV-1a parameters, as in hash/fnv.
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// fnv32a hashes key with FNV-1a without the allocations of hash/fnv, as it
+// runs on every request.
+func fnv32a(key string) uint32 {
+	hash := uint32(fnvOffset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= fnvPrime32
+	}
+	return hash
+}
+
+// HashSelect picks a healthy server by hashing key. Only selectable servers are
+// counted, so the keys of a dead or full server are spread over the rest
+// instead of failing.
+func HashSelect(pool ServerPool, key string) Server {
+	servers := pool.Snapshot().Servers
+
+	alive := 0
+	for _, s := range servers {
+		if s.IsAlive() {
+			alive++
+		}
+	}
+	if alive == 0 {
+		log.Println("Hash: No healthy server found")
+		return nil
+	}
+
+	target := int(fnv32a(key) % uint32(alive))
+
+	for _, s := range servers {
+		if !s.IsAlive() {
+			continue
+		}
+		if target == 0 {
+			return s
+		}
+		target--
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package balancer
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// p2cSampleAttempts bounds how many random probes AlgoP2C makes looking for
+// healthy servers before falling back to a scan of the pool.
+const p2cSampleAttempts = 4
+
+// Power of two choices: sample two healthy servers at random and keep the one
+// with fewer connections relative to its weight. Selection cost does not grow
+// with the pool size and avoids every new connection herding onto the single
+// least loaded server.
+type AlgoP2C struct{}
+
+func (p2c *AlgoP2C) ImplementAlgo(pool ServerPool) Server {
+	snap := pool.Snapshot()
+	servers := snap.Servers
+	if len(servers) == 0 {
+		log.Println("P2C: Pool is empty")
+		return nil
+	}
+
+	first := sampleHealthy(servers, -1)
+	if first < 0 {
+		log.Println("P2C: No healthy server found")
+		return nil
+	}
+
+	second := sampleHealthy(servers, first)
+	if second < 0 {
+		return servers[first]
+	}
+
+	now := time.Now()
+	a, b := servers[first], servers[second]
+	if lessLoaded(b.GetConnCount(), snap.effectiveWeight(b, now), a.GetConnCount(), snap.effectiveWeight(a, now)) {
+		return b
+	}
+	return a
+}
+
+// sampleHealthy returns the index of a random healthy server other than
+// exclude, or -1 if there is none.
+func sampleHealthy(servers []Server, exclude int) int {
+	n := len(servers)
+
+	for i := 0; i < p2cSampleAttempts; i++ {
+		index := rand.IntN(n)
+		if index != exclude && servers[index].IsAlive() {
+			return index
+		}
+	}
+
+	// Random probes kept hitting dead servers; scan from a random offset so the
+	// fallback does not always favour the start of the pool.
+	start := rand.IntN(n)
+	for i := 0; i < n; i++ {
+		index := (start + i) % n
+		if index != exclude && servers[index].IsAlive() {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// lessLoaded reports whether connsA/weightA < connsB/weightB. The comparison is
+// cross-multiplied so low connection counts are not truncated to zero.
+func lessLoaded(connsA, weightA, connsB, weightB int) bool {
+	if weightA <= 0 {
+		weightA = 1
+	}
+	if weightB <= 0 {
+		weightB = 1
+	}
+	return connsA*weightB < connsB*weightA
+}
+
+// Uniform random selection among healthy servers
+type AlgoRandom struct{}
+
+func (r *AlgoRandom) ImplementAlgo(pool ServerPool) Server {
+	servers := pool.Snapshot().Servers
+	if len(servers) == 0 {
+		log.Println("Random: Pool is empty")
+		return nil
+	}
+
+	index := sampleHealthy(servers, -1)
+	if index < 0 {
+		log.Println("Random: No healthy server found")
+		return nil
+	}
+
+	return servers[index]
+}
+
+// Random selection among healthy servers with probability proportional to weight
+type AlgoWRandom struct{}
+
+func (wr *AlgoWRandom) ImplementAlgo(pool ServerPool) Server {
+	snap := pool.Snapshot()
+	now := time.Now()
+
+	total := 0
+	for _, s := range snap.Servers {
+		if s.IsAlive() {
+			total += snap.effectiveWeight(s, now)
+		}
+	}
+
+	if total == 0 {
+		log.Println("Weighted Random: No healthy servers available")
+		return nil
+	}
+
+	// Health can change between the two passes; fall back to the last healthy
+	// server seen rather than returning nothing.
+	pick := rand.IntN(total)
+	sum := 0
+	var last Server
+	for _, s := range snap.Servers {
+		if !s.IsAlive() {
+			continue
+		}
+		weight := snap.effectiveWeight(s, now)
+		if weight <= 0 {
+			continue
+		}
+		last = s
+		sum += weight
+		if pick < sum {
+			return s
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,254 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ParamKind int
+
+const (
+	ParamInt ParamKind = iota
+	ParamFloat
+	ParamBool
+	ParamString
+	ParamDuration
+)
+
+func (k ParamKind) String() string {
+	switch k {
+	case ParamInt:
+		return "int"
+	case ParamFloat:
+		return "float"
+	case ParamBool:
+		return "bool"
+	case ParamString:
+		return "string"
+	case ParamDuration:
+		return "duration"
+	}
+	return "unknown"
+}
+
+// ParamSpec declares a parameter a strategy accepts. Default must already be of
+// the Go type matching Kind (int, float64, bool, string or time.Duration).
+type ParamSpec struct {
+	Name    string
+	Kind    ParamKind
+	Default any
+}
+
+// Params holds validated strategy parameters, one entry per declared ParamSpec.
+type Params map[string]any
+
+func (p Params) Int(name string) int                { v, _ := p[name].(int); return v }
+func (p Params) Float(name string) float64          { v, _ := p[name].(float64); return v }
+func (p Params) Bool(name string) bool              { v, _ := p[name].(bool); return v }
+func (p Params) String(name string) string          { v, _ := p[name].(string); return v }
+func (p Params) Duration(name string) time.Duration { v, _ := p[name].(time.Duration); return v }
+
+// StrategyFactory builds a new, unshared strategy instance from its parameters.
+type StrategyFactory struct {
+	Params []ParamSpec
+	New    func(Params) (LBStrategy, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]StrategyFactory{}
+)
+
+// Register makes a strategy available to pools under name. Packages providing
+// their own strategies call it from init so they only need to be linked in.
+func Register(name string, factory StrategyFactory) error {
+	if name == "" || factory.New == nil {
+		return fmt.Errorf("strategy %q: name and constructor are required", name)
+	}
+
+	seen := map[string]bool{}
+	for _, spec := range factory.Params {
+		if seen[spec.Name] {
+			return fmt.Errorf("strategy %q: duplicate parameter %q", name, spec.Name)
+		}
+		seen[spec.Name] = true
+
+		if spec.Default != nil {
+			if _, err := convertParam(spec.Kind, spec.Default); err != nil {
+				return fmt.Errorf("strategy %q: default for %q: %w", name, spec.Name, err)
+			}
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[name]; exists {
+		return fmt.Errorf("strategy %q is already registered", name)
+	}
+	registry[name] = factory
+	return nil
+}
+
+// MustRegister is like Register but panics on error, for use from init.
+func MustRegister(name string, factory StrategyFactory) {
+	if err := Register(name, factory); err != nil {
+		panic(err)
+	}
+}
+
+// Registered returns the names of all registered strategies, sorted.
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy creates a fresh instance of the named strategy. Unknown names,
+// unknown parameters and values of the wrong type are reported as errors.
+func NewStrategy(algoName string, raw map[string]any) (LBStrategy, error) {
+	if algoName == "" {
+		algoName = DefaultAlgorithm
+	}
+
+	registryMu.RLock()
+	factory, exists := registry[algoName]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown load balancing algorithm %q (registered: %v)", algoName, Registered())
+	}
+
+	params, err := validateParams(factory.Params, raw)
+	if err != nil {
+		return nil, fmt.Errorf("algorithm %q: %w", algoName, err)
+	}
+
+	strategy, err := factory.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("algorithm %q: %w", algoName, err)
+	}
+	return strategy, nil
+}
+
+func validateParams(specs []ParamSpec, raw map[string]any) (Params, error) {
+	params := Params{}
+	known := map[string]bool{}
+
+	for _, spec := range specs {
+		known[spec.Name] = true
+
+		value, set := raw[spec.Name]
+		if !set {
+			if spec.Default != nil {
+				params[spec.Name], _ = convertParam(spec.Kind, spec.Default)
+			}
+			continue
+		}
+
+		converted, err := convertParam(spec.Kind, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", spec.Name, err)
+		}
+		params[spec.Name] = converted
+	}
+
+	for name := range raw {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	return params, nil
+}
+
+// convertParam accepts the value types config decoders commonly produce
+// (strings, float64 from JSON) and converts them to the declared kind.
+func convertParam(kind ParamKind, value any) (any, error) {
+	switch kind {
+	case ParamInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		case string:
+			return strconv.Atoi(v)
+		}
+	case ParamFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case ParamBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case ParamString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case ParamDuration:
+		switch v := value.(type) {
+		case time.Duration:
+			return v, nil
+		case string:
+			return time.ParseDuration(v)
+		}
+	}
+
+	return nil, fmt.Errorf("expected %s, got %T", kind, value)
+}
+
+func simpleFactory(newFn func() LBStrategy) StrategyFactory {
+	return StrategyFactory{
+		New: func(Params) (LBStrategy, error) { return newFn(), nil },
+	}
+}
+
+func init() {
+	MustRegister("round_robin", simpleFactory(NewRRAlgo))
+	MustRegister("weighted_round_robin", simpleFactory(NewWRRAlgo))
+	MustRegister("least_connection", simpleFactory(NewLCountAlgo))
+	MustRegister("weighted_least_connection", simpleFactory(NewWLCountAlgo))
+	MustRegister("power_of_two_choices", simpleFactory(NewP2CAlgo))
+	MustRegister("random", simpleFactory(NewRandomAlgo))
+	MustRegister("weighted_random", simpleFactory(NewWRandomAlgo))
+	MustRegister("adaptive", StrategyFactory{
+		Params: []ParamSpec{
+			{Name: "imbalance_high", Kind: ParamInt, Default: defaultImbalanceHigh},
+			{Name: "imbalance_low", Kind: ParamInt},
+		},
+		New: func(p Params) (LBStrategy, error) {
+			opts := AdaptiveOpts{
+				ImbalanceHigh: p.Int("imbalance_high"),
+				ImbalanceLow:  p.Int("imbalance_low"),
+			}
+			if opts.ImbalanceLow > opts.ImbalanceHigh {
+				return nil, fmt.Errorf("imbalance_low (%d) must not exceed imbalance_high (%d)", opts.ImbalanceLow, opts.ImbalanceHigh)
+			}
+			return NewAdaptiveAlgo(opts), nil
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package balancer
+
+import (
+	"math"
+	"time"
+)
+
+// weightScale keeps effective weights integral while a server is ramping, so a
+// weight-1 server in slow start still gets less than a fully warmed one.
+const weightScale = 100
+
+// EffectiveWeight returns the weight strategies should use for s, scaled by
+// weightScale and reduced while s is inside the pool's slow-start window.
+func EffectiveWeight(pool ServerPool, s Server) int {
+	return pool.Snapshot().effectiveWeight(s, time.Now())
+}
+
+func (snap *Snapshot) effectiveWeight(s Server, now time.Time) int {
+	weight := s.GetWeight()
+	if weight <= 0 {
+		return 0
+	}
+	if snap.SlowStart.Window <= 0 {
+		return weight * weightScale
+	}
+
+	factor := snap.SlowStart.Factor(s.GetHealthySince(), now)
+	return max(int(math.Round(float64(weight*weightScale)*factor)), 1)
+}
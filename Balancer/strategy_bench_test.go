@@ -0,0 +1,66 @@
+package balancer
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+const benchPoolSize = 1024
+
+func benchPool(b *testing.B) *PoolAdapter {
+	b.Helper()
+
+	servers := make([]*backend.Server, benchPoolSize)
+	for i := range servers {
+		servers[i] = backend.NewServer(backend.ServerOpts{
+			Address: fmt.Sprintf("10.0.%d.%d:80", i/256, i%256),
+			Weight:  1 + i%5,
+		})
+		servers[i].AddConnCount(i % 7)
+	}
+	return NewPoolAdapter(backend.NewPool(backend.PoolOpts{Name: "bench", Servers: servers}))
+}
+
+// BenchmarkStrategies measures one selection by every registered strategy.
+// Run with -benchmem; selection is on the hot path of every connection and
+// request.
+func BenchmarkStrategies(b *testing.B) {
+	pool := benchPool(b)
+
+	for _, name := range Registered() {
+		strategy, err := NewStrategy(name, nil)
+		if err != nil {
+			b.Fatalf("%s: %v", name, err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if strategy.ImplementAlgo(pool) == nil {
+					b.Fatal("no server selected")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHashSelect(b *testing.B) {
+	pool := benchPool(b)
+
+	keys := make([]string, 256)
+	for i := range keys {
+		keys[i] = "client-" + strconv.Itoa(i)
+	}
+
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		if HashSelect(pool, keys[i%len(keys)]) == nil {
+			b.Fatal("no server selected")
+		}
+		i++
+	}
+}
@@ -2,56 +2,176 @@ package network
 
 import (
 	"bufio"
-	"fmt"
-	"io"
+	"context"
+	"errors"
 	"log"
 	"net"
-	"strings"
-
-	algorithm "github.com/Faizan2005/Balancer"
+	"sync"
+	"time"
 )
 
 func (p *LBProperties) ListenAndAccept() error {
-	var err error
+	for i, t := range p.Transports {
+		var err error
 
-	p.Transport.Listener, err = net.Listen("tcp", p.Transport.ListenAddr)
-	if err != nil {
-		log.Printf("Failed to listen on %s: %v", p.Transport.ListenAddr, err)
-		return err
+		t.Listener, err = net.Listen("tcp", t.ListenAddr)
+		if err != nil {
+			log.Printf("Failed to listen on %s: %v", t.ListenAddr, err)
+			for _, opened := range p.Transports[:i] {
+				opened.Listener.Close()
+			}
+			return err
+		}
+
+		log.Printf("Listening on %s (mode %s, default pool %q)", t.ListenAddr, t.Mode, t.DefaultPool)
+		p.startL7(t)
+		go p.loopAndAccept(t)
 	}
 
-	go p.loopAndAccept()
+	for i, t := range p.UDPTransports {
+		if err := p.listenUDP(t); err != nil {
+			log.Printf("Failed to listen on UDP %s: %v", t.ListenAddr, err)
+			for _, opened := range p.UDPTransports[:i] {
+				opened.Conn.Close()
+			}
+			for _, opened := range p.Transports {
+				opened.Listener.Close()
+			}
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (p *LBProperties) loopAndAccept() {
+func (p *LBProperties) loopAndAccept(t *TCPTransport) {
 	for {
-		conn, err := p.Transport.Listener.Accept()
+		// At MaxConns, stop accepting and leave new clients in the kernel
+		// backlog until a connection closes.
+		if t.slots != nil {
+			t.slots <- struct{}{}
+		}
+
+		conn, err := t.Listener.Accept()
 		if err != nil {
-			log.Printf("Failed to establish connection with %s: %v", p.Transport.ListenAddr, err)
+			log.Printf("Failed to establish connection with %s: %v", t.ListenAddr, err)
 			return
 		}
 
-		go p.handleConn(conn)
+		if t.slots != nil {
+			conn = &slotConn{Conn: conn, slots: t.slots}
+		}
+		if !t.ACL.Allows(conn.RemoteAddr().String()) ||
+			t.limitsOnAccept(conn.RemoteAddr()) && !allowConn(t.connLimiter, conn) {
+			conn.Close()
+			continue
+		}
+		go p.handleConn(t, conn)
+	}
+}
+
+// slotConn frees its listener slot when closed. The L7 server closes
+// connections itself, so the slot cannot be released when handleConn returns.
+type slotConn struct {
+	net.Conn
+	slots     chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *slotConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { <-c.slots })
+	return err
+}
+
+func (c *slotConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
 	}
+	return nil
 }
 
-func (p *LBProperties) handleConn(conn net.Conn) {
+func (p *LBProperties) handleConn(t *TCPTransport, conn net.Conn) {
 	//	peer := NewTCPPeer(conn)
-	log.Printf("Connection established with %s", conn.RemoteAddr())
+	log.Printf("Connection established with %s on %s", conn.RemoteAddr(), t.ListenAddr)
 
+	conn = limitLifetime(conn, t.Timeouts.MaxLifetime)
 	reader := bufio.NewReader(conn)
-	data, err := reader.Peek(8)
-	if err != nil {
-		log.Println("Error peeking:", err)
+
+	switch t.Mode {
+	case ModeL7:
+		if t.TLS != nil {
+			p.HandleTLS(t, reader, conn)
+		} else {
+			p.HandleHTTP(t, reader, conn)
+		}
+		return
+	case ModeL4:
+		p.proxyL4(t, t.DefaultPool, reader, conn)
+		return
 	}
 
-	if isHTTP(data[:]) {
-		go p.HandleHTTP(reader, conn)
+	peer, unwrapped := conn.RemoteAddr(), false
+	proto, err := sniff(conn, reader, t.Sniff.Timeout, t.Timeouts.Handshake, t.Sniff.Signatures)
+	if _, routed := t.Sniff.Routes[ProtoProxy]; proto == ProtoProxy && !routed {
+		if t.trustsProxy(conn.RemoteAddr()) {
+			// Unwrap the PROXY header and sniff what the real client sent.
+			conn.SetReadDeadline(time.Now().Add(t.Timeouts.Handshake))
+			proxied, perr := readProxyHeader(conn, reader)
+			conn.SetReadDeadline(time.Time{})
+			if perr != nil {
+				log.Printf("Invalid PROXY protocol header from %s: %v", conn.RemoteAddr(), perr)
+				conn.Close()
+				return
+			}
+			conn, unwrapped = proxied, true
+			// Checked on accept against the proxy, now against the client.
+			if !t.ACL.Allows(conn.RemoteAddr().String()) || !allowConn(t.connLimiter, conn) {
+				conn.Close()
+				return
+			}
+			proto, err = sniff(conn, reader, t.Sniff.Timeout, t.Timeouts.Handshake, t.Sniff.Signatures)
+		} else {
+			// Anyone else could claim any client address.
+			log.Printf("Ignoring PROXY protocol header from untrusted %s", conn.RemoteAddr())
+			proto = ProtoUnknown
+		}
+	}
+	if !unwrapped && !t.limitsOnAccept(peer) && !allowConn(t.connLimiter, conn) {
+		conn.Close()
+		return
+	}
+	if errors.Is(err, ErrSilentClient) && t.Sniff.SilentPool != "" {
+		log.Printf("Client %s is silent, assuming server-first protocol", conn.RemoteAddr())
+		p.proxyL4(t, t.Sniff.SilentPool, reader, conn)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to detect protocol from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
 		return
 	}
 
+	log.Printf("Detected protocol %s from %s", proto, conn.RemoteAddr())
+
+	route := t.Sniff.Routes[proto]
+	switch {
+	case route.Handler != nil:
+		route.Handler(t, reader, conn)
+	case route.Pool != "":
+		p.proxyL4(t, route.Pool, reader, conn)
+	case proto == ProtoHTTP1, proto == ProtoHTTP2:
+		p.HandleHTTP(t, reader, conn)
+	case proto == ProtoTLS && t.TLS != nil:
+		p.HandleTLS(t, reader, conn)
+	default:
+		p.proxyL4(t, t.DefaultPool, reader, conn)
+	}
+}
+
+// proxyL4 relays the connection byte for byte to a server from poolName.
+// Anything already buffered in reader (sniffed bytes) is sent first.
+func (p *LBProperties) proxyL4(t *TCPTransport, poolName string, reader *bufio.Reader, conn net.Conn) {
 	defer func() {
 		log.Printf("Closing connection with client %s", conn.RemoteAddr())
 		conn.Close()
@@ -64,47 +184,32 @@ func (p *LBProperties) handleConn(conn net.Conn) {
 	// 	}
 	// }()
 
-	algoName := algorithm.SelectAlgoL4(p.L4ServerPoolInterface)
-
-	log.Printf("Selected algo to implement (%s)", algoName)
-	// algo := p.AlgorithmsMap[algoName]
-	// server := algo.ImplementAlgo(p.ServerPool)
-	server := algorithm.ApplyAlgo(p.L4ServerPoolInterface, algoName, p.AlgorithmsMap)
+	balancer := p.Balancers[poolName]
+	if !allowConn(balancer.Pool.Limiter, conn) {
+		return
+	}
 
-	server.Lock()
-	server.SetConnCount(server.GetConnCount() + 1)
-	server.Unlock()
+	server, err := balancer.Acquire(context.Background())
+	if err != nil {
+		log.Printf("No backend in pool %s for client %s: %v", poolName, conn.RemoteAddr(), err)
+		return
+	}
+	defer balancer.Release(server)
 
-	backendConn, err := net.Dial("tcp", server.GetAddress())
+	dialStart := time.Now()
+	backendConn, err := server.Dial(t.Timeouts.Connect)
+	server.Report(err == nil, time.Since(dialStart))
 	if err != nil {
 		log.Printf("Failed to dial backend: %v", err)
 		return
 	}
 
-	go io.Copy(backendConn, conn) // client → server
-	io.Copy(conn, backendConn)    // server → client
-	log.Print("echoed msg from server to client")
-
-	server.Lock()
-	server.SetConnCount(server.GetConnCount() - 1)
-	server.Unlock()
-
 	defer func() {
 		log.Printf("Closing backend connection with server %s", backendConn.RemoteAddr())
 		backendConn.Close()
 	}()
-}
-
-func isHTTP(data []byte) bool {
-	methods := []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"}
-
-	for _, m := range methods {
-		if strings.HasPrefix(string(data), m+" ") {
-			fmt.Printf("Detected HTTP method: %s\n", m)
-			return true
-		}
-	}
 
-	fmt.Println("Not an HTTP method")
-	return false
+	// client → server (including peeked bytes) and server → client
+	pipe(conn, reader, backendConn, t.Timeouts.Idle, t.Timeouts.MaxLifetime)
+	log.Print("echoed msg from server to client")
 }
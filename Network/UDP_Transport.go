@@ -0,0 +1,259 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+	algorithm "github.com/Faizan2005/Balancer"
+)
+
+const (
+	defaultUDPIdleTimeout = 30 * time.Second
+	maxDatagramSize       = 64 * 1024
+)
+
+// UDPAffinity selects how a new UDP session picks its backend.
+type UDPAffinity string
+
+const (
+	AffinityHash     UDPAffinity = "hash"     // Hash the client IP over healthy servers, whatever its source port
+	AffinityStrategy UDPAffinity = "strategy" // Use the pool's load balancing strategy
+)
+
+type UDPTransportOpts struct {
+	ListenAddr  string
+	Pool        string
+	Affinity    UDPAffinity   // Defaults to AffinityHash
+	IdleTimeout time.Duration // Sessions with no traffic for this long are closed, defaults to 30s
+}
+
+// UDPTransport relays datagrams between clients and a pool. Each client source
+// address gets a session with its own connected socket to one backend, so
+// replies can be routed back to the right client.
+type UDPTransport struct {
+	UDPTransportOpts
+	Conn *net.UDPConn
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+	closed   chan struct{} // Closed once Conn stops reading
+}
+
+type udpSession struct {
+	client     *net.UDPAddr
+	server     *backend.Server
+	balancer   *algorithm.Balancer // Releases server when the session closes
+	upstream   *net.UDPConn
+	lastActive atomic.Int64 // Unix nanoseconds
+	closeOnce  sync.Once
+}
+
+func NewUDPTransport(opts UDPTransportOpts) *UDPTransport {
+	if opts.Affinity == "" {
+		opts.Affinity = AffinityHash
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultUDPIdleTimeout
+	}
+
+	return &UDPTransport{
+		UDPTransportOpts: opts,
+		sessions:         make(map[string]*udpSession),
+	}
+}
+
+// AddUDPTransport registers a UDP listener; it is started by ListenAndAccept.
+func (p *LBProperties) AddUDPTransport(t *UDPTransport) error {
+	if p.Balancers[t.Pool] == nil {
+		return fmt.Errorf("UDP listener %s: unknown pool %q", t.ListenAddr, t.Pool)
+	}
+
+	switch t.Affinity {
+	case AffinityHash, AffinityStrategy:
+	default:
+		return fmt.Errorf("UDP listener %s: unknown affinity %q", t.ListenAddr, t.Affinity)
+	}
+
+	p.UDPTransports = append(p.UDPTransports, t)
+	return nil
+}
+
+func (p *LBProperties) listenUDP(t *UDPTransport) error {
+	addr, err := net.ResolveUDPAddr("udp", t.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	t.Conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[UDP] Listening on %s (pool %q, affinity %s)", t.ListenAddr, t.Pool, t.Affinity)
+	t.closed = make(chan struct{})
+	go p.loopUDP(t)
+	go t.reapIdle()
+
+	return nil
+}
+
+func (p *LBProperties) loopUDP(t *UDPTransport) {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, client, err := t.Conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Printf("[UDP] Failed to read on %s: %v", t.ListenAddr, err)
+			close(t.closed)
+			t.closeAll()
+			return
+		}
+
+		session, err := p.udpSessionFor(t, client)
+		if err != nil {
+			log.Printf("[UDP] Dropping datagram from %s: %v", client, err)
+			continue
+		}
+
+		session.lastActive.Store(time.Now().UnixNano())
+		if _, err := session.upstream.Write(buf[:n]); err != nil {
+			log.Printf("[UDP] Failed to forward datagram from %s to %s: %v", client, session.server.Address, err)
+		}
+	}
+}
+
+func (p *LBProperties) udpSessionFor(t *UDPTransport, client *net.UDPAddr) (*udpSession, error) {
+	key := client.String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if session, exists := t.sessions[key]; exists {
+		return session, nil
+	}
+
+	balancer := p.Balancers[t.Pool]
+
+	var server *backend.Server
+	if t.Affinity == AffinityHash {
+		// Clients such as resolvers pick a new source port per query, so
+		// only the IP keeps them on one server.
+		server = balancer.NextForKey(client.IP.String())
+	} else {
+		server = balancer.Next()
+	}
+	if server == nil {
+		return nil, fmt.Errorf("no healthy backend in pool %q", t.Pool)
+	}
+	if !server.TryAcquire() {
+		return nil, fmt.Errorf("backend %s is at its connection limit", server.Address)
+	}
+
+	upstream, err := dialUDP(server.Address)
+	server.Report(err == nil, 0)
+	if err != nil {
+		balancer.Release(server)
+		return nil, fmt.Errorf("dial %s: %w", server.Address, err)
+	}
+
+	session := &udpSession{
+		client:   client,
+		server:   server,
+		balancer: balancer,
+		upstream: upstream,
+	}
+	session.lastActive.Store(time.Now().UnixNano())
+	t.sessions[key] = session
+
+	log.Printf("[UDP] New session %s -> %s", key, server.Address)
+	go t.relayReplies(session)
+
+	return session, nil
+}
+
+func dialUDP(address string) (*net.UDPConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialUDP("udp", nil, addr)
+}
+
+// relayReplies copies datagrams from the backend back to the session's client
+// until the session is closed.
+func (t *UDPTransport) relayReplies(session *udpSession) {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			t.closeSession(session)
+			return
+		}
+
+		session.lastActive.Store(time.Now().UnixNano())
+		if _, err := t.Conn.WriteToUDP(buf[:n], session.client); err != nil {
+			log.Printf("[UDP] Failed to relay reply to %s: %v", session.client, err)
+		}
+	}
+}
+
+func (t *UDPTransport) reapIdle() {
+	ticker := time.NewTicker(t.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.closed:
+			return
+		}
+		cutoff := time.Now().Add(-t.IdleTimeout).UnixNano()
+
+		t.mu.Lock()
+		var idle []*udpSession
+		for _, session := range t.sessions {
+			if session.lastActive.Load() < cutoff {
+				idle = append(idle, session)
+			}
+		}
+		t.mu.Unlock()
+
+		for _, session := range idle {
+			log.Printf("[UDP] Session %s idle for %v, closing", session.client, t.IdleTimeout)
+			t.closeSession(session)
+		}
+	}
+}
+
+func (t *UDPTransport) closeSession(session *udpSession) {
+	session.closeOnce.Do(func() {
+		t.mu.Lock()
+		if t.sessions[session.client.String()] == session {
+			delete(t.sessions, session.client.String())
+		}
+		t.mu.Unlock()
+
+		session.upstream.Close()
+		// Through the balancer so connections waiting on the pool wake up.
+		session.balancer.Release(session.server)
+	})
+}
+
+func (t *UDPTransport) closeAll() {
+	t.mu.Lock()
+	sessions := make([]*udpSession, 0, len(t.sessions))
+	for _, session := range t.sessions {
+		sessions = append(sessions, session)
+	}
+	t.mu.Unlock()
+
+	for _, session := range sessions {
+		t.closeSession(session)
+	}
+}
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+// udpNameServer answers every datagram with name.
+func udpNameServer(t *testing.T, name string) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			_, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(name), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func startTestUDP(t *testing.T, opts UDPTransportOpts, servers ...*backend.Server) *UDPTransport {
+	t.Helper()
+
+	opts.ListenAddr = "127.0.0.1:0"
+	opts.Pool = "p"
+	transport := NewUDPTransport(opts)
+	pool := backend.NewPool(backend.PoolOpts{Name: "p", Servers: servers})
+
+	lb, err := NewLBProperties(nil, map[string]*backend.Pool{"p": pool}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.UDPTransports = []*UDPTransport{transport}
+	if err := lb.ListenAndAccept(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { transport.Conn.Close() })
+	return transport
+}
+
+func udpExchange(t *testing.T, addr string) string {
+	t.Helper()
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write([]byte("query"))
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestUDPHashAffinityIgnoresSourcePort(t *testing.T) {
+	var servers []*backend.Server
+	for _, name := range []string{"a", "b", "c", "d"} {
+		servers = append(servers, backend.NewServer(backend.ServerOpts{Address: udpNameServer(t, name), Weight: 1}))
+	}
+	transport := startTestUDP(t, UDPTransportOpts{Affinity: AffinityHash}, servers...)
+
+	// Every exchange uses a fresh socket, so a fresh source port.
+	first := udpExchange(t, transport.Conn.LocalAddr().String())
+	for i := 0; i < 10; i++ {
+		if got := udpExchange(t, transport.Conn.LocalAddr().String()); got != first {
+			t.Fatalf("exchange %d went to %s, first went to %s", i, got, first)
+		}
+	}
+}
+
+func TestUDPIdleSessionsReleaseServer(t *testing.T) {
+	server := backend.NewServer(backend.ServerOpts{Address: udpNameServer(t, "a"), Weight: 1})
+	transport := startTestUDP(t, UDPTransportOpts{IdleTimeout: 100 * time.Millisecond}, server)
+
+	udpExchange(t, transport.Conn.LocalAddr().String())
+	if n := server.GetConnCount(); n != 1 {
+		t.Fatalf("ConnCount with a session = %d, want 1", n)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.GetConnCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ConnCount after idle timeout = %d, want 0", server.GetConnCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Closing the listener stops the reaper.
+	transport.Conn.Close()
+	select {
+	case <-transport.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("listener close not signalled to the reaper")
+	}
+}
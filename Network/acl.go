@@ -0,0 +1,118 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ACLOpts lists client addresses as CIDR prefixes or single IPs. Deny wins over
+// Allow; when Allow is empty every address not denied is allowed.
+type ACLOpts struct {
+	Allow []string
+	Deny  []string
+}
+
+// ACL is a reloadable allow/deny list. It is safe for concurrent use and can
+// be shared by several listeners and routes.
+type ACL struct {
+	Name   string       // Used in log lines
+	Denied atomic.Int64 // Connections and requests refused so far
+	rules  atomic.Pointer[aclRules]
+}
+
+type aclRules struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func NewACL(name string, opts ACLOpts) (*ACL, error) {
+	acl := &ACL{Name: name}
+	if err := acl.Reload(opts); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Reload replaces the lists. On error the previous lists stay in effect.
+func (a *ACL) Reload(opts ACLOpts) error {
+	allow, err := parsePrefixes(opts.Allow)
+	if err != nil {
+		return fmt.Errorf("acl %s: allow: %w", a.Name, err)
+	}
+	deny, err := parsePrefixes(opts.Deny)
+	if err != nil {
+		return fmt.Errorf("acl %s: deny: %w", a.Name, err)
+	}
+
+	a.rules.Store(&aclRules{allow: allow, deny: deny})
+	log.Printf("[ACL] %s loaded: %d allow, %d deny", a.Name, len(allow), len(deny))
+	return nil
+}
+
+// Allows reports whether the address (an IP, optionally with a port) may
+// connect. Denials are logged and counted. A nil ACL, or one that was never
+// loaded, allows everything.
+func (a *ACL) Allows(addr string) bool {
+	if a == nil {
+		return true
+	}
+	rules := a.rules.Load()
+	if rules == nil {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(clientIP(addr))
+	if err == nil && rules.allows(ip.Unmap()) {
+		return true
+	}
+
+	a.Denied.Add(1)
+	log.Printf("[ACL] %s denied %s", a.Name, addr)
+	return false
+}
+
+func (r *aclRules) allows(ip netip.Addr) bool {
+	for _, prefix := range r.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(r.allow) == 0 {
+		return true
+	}
+	for _, prefix := range r.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, err
+			}
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
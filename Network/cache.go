@@ -0,0 +1,500 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheMaxBytes       = 64 << 20
+	defaultCacheMaxObjectBytes = 1 << 20
+	defaultCacheDiskMaxBytes   = 1 << 30
+)
+
+type CacheOpts struct {
+	MaxBytes       int64 // Memory budget for cached responses, defaults to 64MiB
+	MaxObjectBytes int64 // Largest body cached, defaults to 1MiB
+	// DiskDir adds a second tier: responses evicted from memory are written
+	// there and read back on a memory miss. Cache files left in it from a
+	// previous run are removed when the cache is created.
+	DiskDir      string
+	DiskMaxBytes int64 // Disk budget, defaults to 1GiB
+}
+
+// ResponseCache is a shared HTTP cache for GET and HEAD requests. It honors
+// Cache-Control, Expires and Vary, revalidates stale responses with ETag or
+// Last-Modified, and lets concurrent misses for the same response wait for one
+// upstream request.
+type ResponseCache struct {
+	CacheOpts
+
+	Hits          atomic.Int64
+	Misses        atomic.Int64
+	Revalidations atomic.Int64 // Stale responses confirmed by a 304
+
+	mu      sync.Mutex
+	store   *cacheStore
+	vary    map[string][]string // Base key to the header names responses vary on
+	flights map[string]chan struct{}
+}
+
+func NewResponseCache(opts CacheOpts) (*ResponseCache, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultCacheMaxBytes
+	}
+	if opts.MaxObjectBytes <= 0 {
+		opts.MaxObjectBytes = defaultCacheMaxObjectBytes
+	}
+	if opts.DiskMaxBytes <= 0 {
+		opts.DiskMaxBytes = defaultCacheDiskMaxBytes
+	}
+
+	store, err := newCacheStore(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResponseCache{
+		CacheOpts: opts,
+		store:     store,
+		vary:      make(map[string][]string),
+		flights:   make(map[string]chan struct{}),
+	}, nil
+}
+
+// cacheEntry is a stored response. The fields are exported for the disk tier.
+type cacheEntry struct {
+	Key     string
+	Path    string
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time // When the response was generated, for Age
+	Expires time.Time // End of freshness
+}
+
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.Body) + len(e.Key))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// validators returns the conditional headers that revalidate the entry, or
+// nil if it has none.
+func (e *cacheEntry) validators() http.Header {
+	h := make(http.Header)
+	if etag := e.Header.Get("Etag"); etag != "" {
+		h.Set("If-None-Match", etag)
+	}
+	if modified := e.Header.Get("Last-Modified"); modified != "" {
+		h.Set("If-Modified-Since", modified)
+	}
+	if len(h) == 0 {
+		return nil
+	}
+	return h
+}
+
+// fetchFunc sends the request upstream with the given conditional headers. It
+// returns nil if it already answered the client with an error, otherwise the
+// response and a func to call once it has been used.
+type fetchFunc func(conditional http.Header) (*http.Response, func())
+
+// cacheableRequest reports whether r may be answered from a shared cache.
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" || isGRPC(r) {
+		return false
+	}
+	_, noStore := parseCacheControl(r.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// serve answers r from the cache or from upstream through fetch, storing
+// what can be stored. write sends a response to the client.
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, fetch fetchFunc, write func(*http.Response)) {
+	base := cacheBaseKey(r)
+	key := c.variantKey(base, r)
+	revalidate := requestForcesRevalidation(r)
+
+	entry := c.store.get(key)
+	if entry != nil && entry.fresh(time.Now()) && !revalidate {
+		c.Hits.Add(1)
+		c.writeEntry(w, r, entry, "HIT", write)
+		return
+	}
+
+	// Concurrent misses wait for the first one, then look again. Only GETs
+	// are stored, so a HEAD only waits for other HEADs.
+	release := func() {}
+	flight := r.Method + " " + key
+	if wait, leader := c.join(flight); !leader {
+		select {
+		case <-wait:
+		case <-r.Context().Done():
+			return
+		}
+
+		key = c.variantKey(base, r)
+		if entry = c.store.get(key); entry != nil && entry.fresh(time.Now()) {
+			c.Hits.Add(1)
+			c.writeEntry(w, r, entry, "HIT", write)
+			return
+		}
+	} else {
+		// Waiters are let go as soon as the response is stored, not when
+		// this client has received it.
+		release = sync.OnceFunc(func() { c.leave(flight) })
+		defer release()
+	}
+
+	c.Misses.Add(1)
+	c.refresh(w, r, base, entry, fetch, write, release)
+}
+
+// refresh fetches r from upstream, revalidating stale if it is set. release
+// is called once the outcome is in the store, before writing to the client.
+func (c *ResponseCache) refresh(w http.ResponseWriter, r *http.Request, base string, stale *cacheEntry, fetch fetchFunc, write func(*http.Response), release func()) {
+	conditional := http.Header{}
+	if stale != nil {
+		if v := stale.validators(); v != nil {
+			conditional = v
+		}
+	}
+
+	resp, done := fetch(conditional)
+	if resp == nil {
+		return
+	}
+	defer done()
+
+	now := time.Now()
+
+	if resp.StatusCode == http.StatusNotModified && stale != nil {
+		c.Revalidations.Add(1)
+		updated := *stale
+		updated.Header = stale.Header.Clone()
+		for name, values := range resp.Header {
+			updated.Header[name] = values
+		}
+		lifetime, _ := responseFreshness(updated.Header, now)
+		updated.Stored = responseDate(updated.Header, now)
+		updated.Expires = now.Add(lifetime)
+		c.store.put(&updated)
+		release()
+		log.Printf("[CACHE] Revalidated %q", stale.Key)
+		c.writeEntry(w, r, &updated, "REVALIDATED", write)
+		return
+	}
+
+	lifetime, storable := responseFreshness(resp.Header, now)
+	if !storable || r.Method != http.MethodGet || !cacheableStatus(resp.StatusCode) ||
+		resp.Header.Get("Set-Cookie") != "" || resp.ContentLength > c.MaxObjectBytes {
+		if stale != nil {
+			c.store.remove(stale.Key)
+		}
+		release()
+		resp.Header.Set("X-Cache", "MISS")
+		write(resp)
+		return
+	}
+
+	vary, ok := varyHeaders(resp.Header)
+	if !ok {
+		release()
+		resp.Header.Set("X-Cache", "MISS")
+		write(resp)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.MaxObjectBytes+1))
+	if err != nil || int64(len(body)) > c.MaxObjectBytes {
+		// Too large to store or cut short; pass on what there is.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		release()
+		resp.Header.Set("X-Cache", "MISS")
+		write(resp)
+		return
+	}
+
+	c.mu.Lock()
+	c.vary[base] = vary
+	c.mu.Unlock()
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	entry := &cacheEntry{
+		Key:     base + varySignature(vary, r),
+		Path:    r.URL.Path,
+		Status:  resp.StatusCode,
+		Header:  header,
+		Body:    body,
+		Stored:  responseDate(header, now),
+		Expires: now.Add(lifetime),
+	}
+	c.store.put(entry)
+	release()
+	log.Printf("[CACHE] Stored %q (%d bytes, fresh for %v)", entry.Key, len(body), lifetime)
+
+	c.writeEntry(w, r, entry, "MISS", write)
+}
+
+// writeEntry answers r from entry, with 304 if the client already has it.
+func (c *ResponseCache) writeEntry(w http.ResponseWriter, r *http.Request, entry *cacheEntry, status string, write func(*http.Response)) {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.Itoa(max(int(time.Since(entry.Stored).Seconds()), 0)))
+	header.Set("X-Cache", status)
+
+	if notModified(r, entry.Header) {
+		header.Del("Content-Length")
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	write(&http.Response{
+		StatusCode:    entry.Status,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+	})
+}
+
+// join registers a fetch for key. The first caller leads and must call leave;
+// the others get a channel closed when the leader is done.
+func (c *ResponseCache) join(key string) (chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if wait, exists := c.flights[key]; exists {
+		return wait, false
+	}
+	c.flights[key] = make(chan struct{})
+	return nil, true
+}
+
+func (c *ResponseCache) leave(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	close(c.flights[key])
+	delete(c.flights, key)
+}
+
+// variantKey returns the key for r's variant of base, using the Vary headers
+// last seen for it.
+func (c *ResponseCache) variantKey(base string, r *http.Request) string {
+	c.mu.Lock()
+	vary := c.vary[base]
+	c.mu.Unlock()
+
+	return base + varySignature(vary, r)
+}
+
+// Purge removes the cached responses for path, in every variant and query.
+// It returns how many were removed.
+func (c *ResponseCache) Purge(path string) int {
+	n := c.store.purge(func(p string) bool { return p == path })
+	log.Printf("[CACHE] Purged %d responses for %s", n, path)
+	return n
+}
+
+// PurgePrefix removes the cached responses for paths starting with prefix.
+func (c *ResponseCache) PurgePrefix(prefix string) int {
+	n := c.store.purge(func(p string) bool { return strings.HasPrefix(p, prefix) })
+	log.Printf("[CACHE] Purged %d responses under %s", n, prefix)
+	return n
+}
+
+// PurgeHandler serves cache purges for an admin listener:
+// DELETE ?path=/logo.png or DELETE ?prefix=/assets/.
+func (c *ResponseCache) PurgeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "DELETE, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var n int
+		query := r.URL.Query()
+		switch {
+		case query.Get("path") != "":
+			n = c.Purge(query.Get("path"))
+		case query.Get("prefix") != "":
+			n = c.PurgePrefix(query.Get("prefix"))
+		default:
+			http.Error(w, "path or prefix required", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"purged":` + strconv.Itoa(n) + "}\n"))
+	})
+}
+
+func cacheBaseKey(r *http.Request) string {
+	return strings.ToLower(r.Host) + r.URL.RequestURI()
+}
+
+// varyHeaders returns the canonical, sorted header names resp varies on. It
+// returns false for "Vary: *", which can never be matched.
+func varyHeaders(h http.Header) ([]string, bool) {
+	var names []string
+	for _, field := range h.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+func varySignature(names []string, r *http.Request) string {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func cacheableStatus(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func requestForcesRevalidation(r *http.Request) bool {
+	cc := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, noCache := cc["no-cache"]; noCache {
+		return true
+	}
+	return cc["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache"
+}
+
+// responseFreshness returns how long a response stays fresh, and whether a
+// shared cache may store it at all: it must not be private or no-store, and
+// needs either a freshness lifetime or a validator to revalidate with.
+func responseFreshness(h http.Header, now time.Time) (time.Duration, bool) {
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	if _, noStore := cc["no-store"]; noStore {
+		return 0, false
+	}
+	if _, private := cc["private"]; private {
+		return 0, false
+	}
+
+	var lifetime time.Duration
+	if v, ok := cc["s-maxage"]; ok {
+		lifetime = parseSeconds(v)
+	} else if v, ok := cc["max-age"]; ok {
+		lifetime = parseSeconds(v)
+	} else if expires := h.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			lifetime = t.Sub(responseDate(h, now))
+		}
+	}
+	if _, noCache := cc["no-cache"]; noCache {
+		lifetime = 0
+	}
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	lifetime = max(lifetime, 0)
+
+	hasValidator := h.Get("Etag") != "" || h.Get("Last-Modified") != ""
+	return lifetime, lifetime > 0 || hasValidator
+}
+
+// responseDate returns when the response was generated, from Date and Age.
+func responseDate(h http.Header, now time.Time) time.Time {
+	date := now
+	if t, err := http.ParseTime(h.Get("Date")); err == nil && t.Before(now) {
+		date = t
+	}
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+		date = date.Add(-time.Duration(age) * time.Second)
+	}
+	return date
+}
+
+func parseSeconds(v string) time.Duration {
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// notModified reports whether r's conditional headers match the cached
+// response's validators.
+func notModified(r *http.Request, h http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(h.Get("Etag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		modified, merr := http.ParseTime(h.Get("Last-Modified"))
+		return err == nil && merr == nil && !modified.After(sinceTime)
+	}
+
+	return false
+}
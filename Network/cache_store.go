@@ -0,0 +1,235 @@
+package network
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const cacheFileExt = ".cache"
+
+// cacheStore keeps entries in a memory LRU bounded by bytes. With a disk
+// directory, entries evicted from memory move to a second LRU on disk and are
+// promoted back to memory when read.
+type cacheStore struct {
+	opts CacheOpts
+
+	mu     sync.Mutex
+	memory lruIndex
+	disk   lruIndex
+}
+
+// lruIndex orders keys from most to least recently used.
+type lruIndex struct {
+	order *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+type lruItem struct {
+	key   string
+	path  string
+	size  int64
+	entry *cacheEntry // Nil for items on disk
+}
+
+func newLRUIndex() lruIndex {
+	return lruIndex{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *lruIndex) add(item *lruItem) {
+	l.items[item.key] = l.order.PushFront(item)
+	l.bytes += item.size
+}
+
+func (l *lruIndex) remove(key string) *lruItem {
+	elem, exists := l.items[key]
+	if !exists {
+		return nil
+	}
+	item := l.order.Remove(elem).(*lruItem)
+	delete(l.items, key)
+	l.bytes -= item.size
+	return item
+}
+
+func (l *lruIndex) oldest() *lruItem {
+	if elem := l.order.Back(); elem != nil {
+		return elem.Value.(*lruItem)
+	}
+	return nil
+}
+
+func newCacheStore(opts CacheOpts) (*cacheStore, error) {
+	if opts.DiskDir != "" {
+		if err := os.MkdirAll(opts.DiskDir, 0o755); err != nil {
+			return nil, err
+		}
+		stale, _ := filepath.Glob(filepath.Join(opts.DiskDir, "*"+cacheFileExt))
+		for _, file := range stale {
+			os.Remove(file)
+		}
+	}
+
+	return &cacheStore{
+		opts:   opts,
+		memory: newLRUIndex(),
+		disk:   newLRUIndex(),
+	}, nil
+}
+
+// get returns the entry for key from memory or disk, or nil.
+func (s *cacheStore) get(key string) *cacheEntry {
+	s.mu.Lock()
+	if elem, exists := s.memory.items[key]; exists {
+		s.memory.order.MoveToFront(elem)
+		s.mu.Unlock()
+		return elem.Value.(*lruItem).entry
+	}
+	_, onDisk := s.disk.items[key]
+	s.mu.Unlock()
+
+	if !onDisk {
+		return nil
+	}
+
+	entry, err := s.readFile(key)
+	if err != nil {
+		log.Printf("[CACHE] Failed to read %q from disk: %v", key, err)
+		s.remove(key)
+		return nil
+	}
+
+	// Back in memory; it is written out again if evicted.
+	os.Remove(s.fileName(key))
+	s.put(entry)
+	return entry
+}
+
+// put stores entry in memory, replacing any previous one for its key, and
+// evicts what no longer fits.
+func (s *cacheStore) put(entry *cacheEntry) {
+	s.mu.Lock()
+
+	s.removeLocked(entry.Key)
+	s.memory.add(&lruItem{key: entry.Key, path: entry.Path, size: entry.size(), entry: entry})
+
+	var spilled []*cacheEntry
+	for s.memory.bytes > s.opts.MaxBytes {
+		item := s.memory.remove(s.memory.oldest().key)
+		if s.opts.DiskDir == "" || item.size > s.opts.DiskMaxBytes {
+			continue
+		}
+		s.disk.add(&lruItem{key: item.key, path: item.path, size: item.size})
+		spilled = append(spilled, item.entry)
+	}
+
+	var dropped []string
+	for s.disk.bytes > s.opts.DiskMaxBytes {
+		dropped = append(dropped, s.disk.remove(s.disk.oldest().key).key)
+	}
+
+	s.mu.Unlock()
+
+	for _, e := range spilled {
+		if err := s.writeFile(e); err != nil {
+			log.Printf("[CACHE] Failed to write %q to disk: %v", e.Key, err)
+			s.remove(e.Key)
+			continue
+		}
+
+		// Purged or replaced while it was being written
+		s.mu.Lock()
+		_, onDisk := s.disk.items[e.Key]
+		s.mu.Unlock()
+		if !onDisk {
+			os.Remove(s.fileName(e.Key))
+		}
+	}
+	for _, key := range dropped {
+		os.Remove(s.fileName(key))
+	}
+}
+
+func (s *cacheStore) remove(key string) {
+	s.mu.Lock()
+	onDisk := s.removeLocked(key)
+	s.mu.Unlock()
+
+	if onDisk {
+		os.Remove(s.fileName(key))
+	}
+}
+
+// removeLocked drops key from both tiers and reports whether it was on disk.
+func (s *cacheStore) removeLocked(key string) bool {
+	s.memory.remove(key)
+	return s.disk.remove(key) != nil
+}
+
+// purge removes every entry whose path matches and returns how many.
+func (s *cacheStore) purge(match func(path string) bool) int {
+	s.mu.Lock()
+
+	n := 0
+	var files []string
+	for _, index := range []*lruIndex{&s.memory, &s.disk} {
+		for key, elem := range index.items {
+			if match(elem.Value.(*lruItem).path) {
+				if index.remove(key).entry == nil {
+					files = append(files, s.fileName(key))
+				}
+				n++
+			}
+		}
+	}
+
+	s.mu.Unlock()
+
+	for _, file := range files {
+		os.Remove(file)
+	}
+	return n
+}
+
+func (s *cacheStore) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.opts.DiskDir, hex.EncodeToString(sum[:])+cacheFileExt)
+}
+
+func (s *cacheStore) writeFile(entry *cacheEntry) error {
+	// Write to a temporary file first so readers never see a partial entry.
+	file, err := os.CreateTemp(s.opts.DiskDir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := gob.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.fileName(entry.Key))
+}
+
+func (s *cacheStore) readFile(key string) (*cacheEntry, error) {
+	file, err := os.Open(s.fileName(key))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entry := new(cacheEntry)
+	if err := gob.NewDecoder(file).Decode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
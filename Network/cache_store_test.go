@@ -0,0 +1,143 @@
+package network
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func storeEntry(key string, size int) *cacheEntry {
+	return &cacheEntry{Key: key, Path: "/" + key, Status: 200, Body: bytes.Repeat([]byte("x"), size-len(key))}
+}
+
+func diskFiles(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+cacheFileExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestCacheStoreMemoryLRU(t *testing.T) {
+	s, err := newCacheStore(CacheOpts{MaxBytes: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.put(storeEntry("a", 100))
+	s.put(storeEntry("b", 100))
+	s.put(storeEntry("c", 100))
+	s.get("a") // Now b is the least recently used
+	s.put(storeEntry("d", 100))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if got := s.get(key) != nil; got != want {
+			t.Errorf("%s cached = %v, want %v", key, got, want)
+		}
+	}
+	if s.memory.bytes != 300 {
+		t.Errorf("memory bytes = %d, want 300", s.memory.bytes)
+	}
+}
+
+func TestCacheStoreDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newCacheStore(CacheOpts{MaxBytes: 200, DiskDir: dir, DiskMaxBytes: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.put(storeEntry("a", 100))
+	s.put(storeEntry("b", 100))
+	s.put(storeEntry("c", 100)) // Spills a to disk
+
+	if _, inMemory := s.memory.items["a"]; inMemory {
+		t.Fatal("a still in memory")
+	}
+	if n := diskFiles(t, dir); n != 1 {
+		t.Fatalf("%d files on disk, want 1", n)
+	}
+
+	// Reading a promotes it back to memory, spilling b in its place.
+	entry := s.get("a")
+	if entry == nil || entry.Path != "/a" || len(entry.Body) != 99 {
+		t.Fatalf("promoted entry = %+v", entry)
+	}
+	if _, inMemory := s.memory.items["a"]; !inMemory {
+		t.Error("a not promoted to memory")
+	}
+	if _, onDisk := s.disk.items["b"]; !onDisk {
+		t.Error("b not spilled to disk")
+	}
+	if n := diskFiles(t, dir); n != 1 {
+		t.Errorf("%d files on disk after promotion, want 1", n)
+	}
+
+	// The disk tier is bounded too.
+	s.put(storeEntry("d", 100))
+	s.put(storeEntry("e", 100))
+	s.put(storeEntry("f", 100))
+	if s.disk.bytes > 200 {
+		t.Errorf("disk bytes = %d, over budget", s.disk.bytes)
+	}
+	if n := diskFiles(t, dir); n != len(s.disk.items) {
+		t.Errorf("%d files on disk, index has %d", n, len(s.disk.items))
+	}
+}
+
+func TestCacheStoreSkipsOversizedSpill(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newCacheStore(CacheOpts{MaxBytes: 150, DiskDir: dir, DiskMaxBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.put(storeEntry("big", 150))
+	s.put(storeEntry("a", 50))
+	if s.get("big") != nil {
+		t.Error("entry larger than the disk budget kept")
+	}
+	if n := diskFiles(t, dir); n != 0 {
+		t.Errorf("%d files on disk, want 0", n)
+	}
+}
+
+func TestCacheStorePurge(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newCacheStore(CacheOpts{MaxBytes: 100, DiskDir: dir, DiskMaxBytes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.put(storeEntry("assets-a", 100))
+	s.put(storeEntry("assets-b", 100)) // Spills assets-a
+	s.put(storeEntry("other", 100))    // Spills assets-b
+
+	n := s.purge(func(path string) bool { return path == "/assets-a" || path == "/assets-b" })
+	if n != 2 {
+		t.Errorf("purged %d, want 2", n)
+	}
+	if diskFiles(t, dir) != 0 {
+		t.Error("purged entries left on disk")
+	}
+	if s.get("other") == nil {
+		t.Error("unmatched entry purged")
+	}
+}
+
+func TestCacheStoreRemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "old"+cacheFileExt)
+	if err := os.WriteFile(stale, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newCacheStore(CacheOpts{MaxBytes: 100, DiskDir: dir, DiskMaxBytes: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("cache file from a previous run kept")
+	}
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func header(pairs ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(pairs); i += 2 {
+		h.Add(pairs[i], pairs[i+1])
+	}
+	return h
+}
+
+func TestResponseFreshness(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-10 * time.Second).Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		header       http.Header
+		wantLifetime time.Duration
+		wantStorable bool
+	}{
+		{"max-age", header("Cache-Control", "max-age=60"), time.Minute, true},
+		{"s-maxage wins", header("Cache-Control", "max-age=60, s-maxage=30"), 30 * time.Second, true},
+		{"quoted and mixed case", header("Cache-Control", `Max-Age="60"`), time.Minute, true},
+		{"age subtracted", header("Cache-Control", "max-age=60", "Age", "15"), 45 * time.Second, true},
+		{"age beyond lifetime", header("Cache-Control", "max-age=60", "Age", "90"), 0, false},
+		{"expires from date", header("Date", date, "Expires", now.Add(50*time.Second).Format(http.TimeFormat)), time.Minute, true},
+		{"expires in the past", header("Expires", now.Add(-time.Hour).Format(http.TimeFormat)), 0, false},
+		{"invalid max-age", header("Cache-Control", "max-age=soon"), 0, false},
+		{"negative max-age", header("Cache-Control", "max-age=-5"), 0, false},
+		{"no-store", header("Cache-Control", "no-store, max-age=60"), 0, false},
+		{"private", header("Cache-Control", "private, max-age=60"), 0, false},
+		{"no-cache with validator", header("Cache-Control", "no-cache, max-age=60", "Etag", `"v1"`), 0, true},
+		{"no-cache without validator", header("Cache-Control", "no-cache"), 0, false},
+		{"only last-modified", header("Last-Modified", date), 0, true},
+		{"nothing", header(), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifetime, storable := responseFreshness(tt.header, now)
+			if lifetime != tt.wantLifetime || storable != tt.wantStorable {
+				t.Errorf("got %v, %v; want %v, %v", lifetime, storable, tt.wantLifetime, tt.wantStorable)
+			}
+		})
+	}
+}
+
+func TestResponseDate(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Time
+	}{
+		{"no date", header(), now},
+		{"date", header("Date", now.Add(-time.Minute).Format(http.TimeFormat)), now.Add(-time.Minute)},
+		{"date in the future", header("Date", now.Add(time.Hour).Format(http.TimeFormat)), now},
+		{"age", header("Age", "30"), now.Add(-30 * time.Second)},
+		{"date and age", header("Date", now.Add(-time.Minute).Format(http.TimeFormat), "Age", "30"), now.Add(-90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseDate(tt.header, now); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cached := header("Etag", `"v1"`, "Last-Modified", modified.Format(http.TimeFormat))
+
+	tests := []struct {
+		name    string
+		request http.Header
+		cached  http.Header
+		want    bool
+	}{
+		{"matching etag", header("If-None-Match", `"v1"`), cached, true},
+		{"etag in list", header("If-None-Match", `"v0", "v1"`), cached, true},
+		{"weak comparison", header("If-None-Match", `W/"v1"`), cached, true},
+		{"weak cached etag", header("If-None-Match", `"v1"`), header("Etag", `W/"v1"`), true},
+		{"star", header("If-None-Match", "*"), cached, true},
+		{"other etag", header("If-None-Match", `"v2"`), cached, false},
+		{"no cached etag", header("If-None-Match", "*"), header(), false},
+		{"etag wins over date", header("If-None-Match", `"v2"`, "If-Modified-Since", modified.Format(http.TimeFormat)), cached, false},
+		{"not modified since", header("If-Modified-Since", modified.Format(http.TimeFormat)), cached, true},
+		{"modified since", header("If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat)), cached, false},
+		{"invalid date", header("If-Modified-Since", "yesterday"), cached, false},
+		{"unconditional", header(), cached, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header = tt.request
+			if got := notModified(r, tt.cached); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaryHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   []string
+		wantOK bool
+	}{
+		{"none", header(), nil, true},
+		{"canonical and sorted", header("Vary", "accept-encoding, Accept-Language"), []string{"Accept-Encoding", "Accept-Language"}, true},
+		{"several fields", header("Vary", "Origin", "Vary", "Accept"), []string{"Accept", "Origin"}, true},
+		{"empty items", header("Vary", "Accept,, "), []string{"Accept"}, true},
+		{"star", header("Vary", "Accept, *"), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := varyHeaders(tt.header)
+			if !reflect.DeepEqual(got, tt.want) || ok != tt.wantOK {
+				t.Errorf("got %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVarySignature(t *testing.T) {
+	names := []string{"Accept-Encoding"}
+
+	gzip := httptest.NewRequest(http.MethodGet, "/", nil)
+	gzip.Header.Set("Accept-Encoding", "gzip")
+	plain := httptest.NewRequest(http.MethodGet, "/", nil)
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.Header.Set("Accept-Language", "de")
+
+	if varySignature(names, gzip) == varySignature(names, plain) {
+		t.Error("requests with different Accept-Encoding share a variant")
+	}
+	if varySignature(names, plain) != varySignature(names, other) {
+		t.Error("a header outside Vary split the variant")
+	}
+	if varySignature(nil, gzip) != "" {
+		t.Error("no Vary should add nothing to the key")
+	}
+}
+
+func TestRequestForcesRevalidation(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   bool
+	}{
+		{header(), false},
+		{header("Cache-Control", "no-cache"), true},
+		{header("Cache-Control", "max-age=0"), true},
+		{header("Cache-Control", "max-age=60"), false},
+		{header("Pragma", "no-cache"), true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header = tt.header
+		if got := requestForcesRevalidation(r); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package network
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderFactory wraps w in a compressing writer for one Content-Encoding.
+// Closing the writer must flush everything but leave w open.
+type EncoderFactory func(w io.Writer) io.WriteCloser
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFactory{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw },
+	}
+)
+
+// RegisterEncoder adds or replaces a Content-Encoding. gzip and deflate are
+// built in; brotli has no standard library implementation, so register one
+// as "br" from a third-party package to offer it.
+func RegisterEncoder(name string, factory EncoderFactory) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[strings.ToLower(name)] = factory
+}
+
+func encoder(name string) EncoderFactory {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return encoders[name]
+}
+
+var (
+	defaultCompressEncodings = []string{"br", "gzip", "deflate"}
+	defaultCompressTypes     = []string{
+		"text/",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/xhtml+xml",
+		"image/svg+xml",
+	}
+)
+
+const defaultCompressMinSize = 1024
+
+// CompressionOpts configures response compression on a listener or route.
+// A route's options replace the listener's; set Disabled on a route to turn
+// compression off for it.
+type CompressionOpts struct {
+	Disabled bool
+	// MinSize skips responses whose Content-Length is smaller, defaults to
+	// 1KiB. Responses of unknown length are compressed.
+	MinSize int64
+	// ContentTypes lists media types to compress, a trailing "/" matching a
+	// whole type. Defaults to text and common JSON, JavaScript, XML and SVG.
+	ContentTypes []string
+	// Encodings in order of preference, defaults to br, gzip and deflate.
+	// Encodings without a registered encoder are skipped.
+	Encodings []string
+}
+
+func (t *TCPTransport) compressionFor(route *Route) *CompressionOpts {
+	if route != nil && route.Compression != nil {
+		return route.Compression
+	}
+	return t.Compression
+}
+
+// encodingFor picks the encoding for resp, or "" if it should be sent as is:
+// compression is off, the client does not accept any configured encoding,
+// or the response is already encoded, too small, partial or of another type.
+func (o *CompressionOpts) encodingFor(r *http.Request, resp *http.Response) string {
+	if o == nil || o.Disabled || r.Method == http.MethodHead {
+		return ""
+	}
+
+	switch {
+	case resp.StatusCode < http.StatusOK,
+		resp.StatusCode == http.StatusNoContent,
+		resp.StatusCode == http.StatusPartialContent,
+		resp.StatusCode == http.StatusNotModified:
+		return ""
+	}
+
+	if resp.Header.Get("Content-Encoding") != "" || strings.Contains(resp.Header.Get("Cache-Control"), "no-transform") {
+		return ""
+	}
+
+	minSize := o.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressMinSize
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < minSize {
+		return ""
+	}
+
+	if !o.compressible(resp.Header.Get("Content-Type")) {
+		return ""
+	}
+
+	encodings := o.Encodings
+	if len(encodings) == 0 {
+		encodings = defaultCompressEncodings
+	}
+	accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+	for _, name := range encodings {
+		if accepted[name] && encoder(name) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func (o *CompressionOpts) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	types := o.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	for _, t := range types {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncodings parses Accept-Encoding, leaving out codings with q=0.
+func acceptedEncodings(header string) map[string]bool {
+	accepted := make(map[string]bool)
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	return accepted
+}
+
+// compressWriter sends the body through an encoder. Flush pushes out what the
+// encoder holds so streamed responses still arrive promptly.
+type compressWriter struct {
+	http.ResponseWriter
+	encoder io.WriteCloser
+}
+
+// startCompression sets the headers for encoding and returns a writer that
+// compresses into w. Call it before WriteHeader and close the writer after the
+// body.
+func startCompression(w http.ResponseWriter, encoding string) *compressWriter {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	h.Set("Content-Encoding", encoding)
+	h.Add("Vary", "Accept-Encoding")
+	// The encoded body differs byte for byte, so a strong validator no longer
+	// holds.
+	if etag := h.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("Etag", "W/"+etag)
+	}
+
+	return &compressWriter{ResponseWriter: w, encoder: encoder(encoding)(w)}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	return c.encoder.Write(p)
+}
+
+func (c *compressWriter) FlushError() error {
+	if f, ok := c.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *compressWriter) Close() {
+	if err := c.encoder.Close(); err != nil {
+		log.Printf("[HTTP_HANDLER] Error finishing compressed response: %v", err)
+	}
+}
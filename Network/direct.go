@@ -0,0 +1,126 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RedirectOpts answers a route with a redirect. Target is a template where
+// {scheme}, {host} (with port), {hostname} (without), {path}, {query} and
+// {request_uri} (path and query) are replaced from the request, e.g.
+// "https://{host}{request_uri}" or "https://www.example.com{request_uri}".
+type RedirectOpts struct {
+	Status int // 301, 302, 307 or 308, defaults to 302
+	Target string
+}
+
+// DirectResponse answers a route with a fixed response, e.g. a maintenance
+// page or a health response for an upstream load balancer.
+type DirectResponse struct {
+	Status  int // Defaults to 200
+	Headers map[string]string
+	Body    []byte
+}
+
+type DirectResponseOpts struct {
+	Status  int
+	Headers map[string]string
+	Body    string
+	// BodyFile is read once when the response is created and takes
+	// precedence over Body.
+	BodyFile string
+}
+
+func NewDirectResponse(opts DirectResponseOpts) (*DirectResponse, error) {
+	if opts.Status == 0 {
+		opts.Status = http.StatusOK
+	}
+	resp := &DirectResponse{Status: opts.Status, Headers: opts.Headers, Body: []byte(opts.Body)}
+	if err := resp.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.BodyFile != "" {
+		var err error
+		if resp.Body, err = os.ReadFile(opts.BodyFile); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (o *RedirectOpts) validate() error {
+	switch o.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("redirect status %d is not 301, 302, 307 or 308", o.Status)
+	}
+	if o.Target == "" {
+		return fmt.Errorf("redirect has no target")
+	}
+	return nil
+}
+
+func (d *DirectResponse) validate() error {
+	if d.Status != 0 && (d.Status < 100 || d.Status > 999) {
+		return fmt.Errorf("invalid status %d", d.Status)
+	}
+	return nil
+}
+
+// direct reports whether the route answers requests itself.
+func (route *Route) direct() bool {
+	return route != nil && (route.Redirect != nil || route.Respond != nil)
+}
+
+// respondDirect answers r from the route's redirect or direct response.
+func (route *Route) respondDirect(w http.ResponseWriter, r *http.Request) {
+	if route.Redirect != nil {
+		status := route.Redirect.Status
+		if status == 0 {
+			status = http.StatusFound
+		}
+		target := redirectTarget(route.Redirect.Target, r)
+		log.Printf("[HTTP_HANDLER] Route %s redirects %s to %s (%d)", route.Name, r.URL.Path, target, status)
+		http.Redirect(w, r, target, status)
+		return
+	}
+
+	resp := route.Respond
+	for name, value := range resp.Headers {
+		w.Header().Set(name, value)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(resp.Body))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+	log.Printf("[HTTP_HANDLER] Route %s answered %s with %d", route.Name, r.URL.Path, status)
+}
+
+func redirectTarget(template string, r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return strings.NewReplacer(
+		"{scheme}", scheme,
+		"{host}", r.Host,
+		"{hostname}", requestHost(r),
+		"{path}", r.URL.EscapedPath(),
+		"{query}", r.URL.RawQuery,
+		"{request_uri}", r.URL.RequestURI(),
+	).Replace(template)
+}
@@ -0,0 +1,74 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondDirect(t *testing.T) {
+	tests := []struct {
+		name       string
+		route      *Route
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:       "zero status defaults to 200",
+			route:      &Route{Name: "r", Respond: &DirectResponse{Body: []byte("ok")}},
+			method:     http.MethodGet,
+			target:     "http://example.com/health",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "HEAD has no body",
+			route:      &Route{Name: "r", Respond: &DirectResponse{Status: http.StatusServiceUnavailable, Body: []byte("down")}},
+			method:     http.MethodHead,
+			target:     "http://example.com/",
+			wantStatus: http.StatusServiceUnavailable,
+			wantHeader: map[string]string{"Content-Length": "4"},
+		},
+		{
+			name:       "redirect template",
+			route:      &Route{Name: "r", Redirect: &RedirectOpts{Status: http.StatusMovedPermanently, Target: "https://{hostname}{request_uri}"}},
+			method:     http.MethodGet,
+			target:     "http://example.com:8080/a/b?c=d",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: map[string]string{"Location": "https://example.com/a/b?c=d"},
+		},
+		{
+			name:       "redirect defaults to 302",
+			route:      &Route{Name: "r", Redirect: &RedirectOpts{Target: "/elsewhere"}},
+			method:     http.MethodGet,
+			target:     "http://example.com/",
+			wantStatus: http.StatusFound,
+			wantHeader: map[string]string{"Location": "/elsewhere"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.route.respondDirect(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.method == http.MethodHead && w.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q, want none", w.Body.String())
+			}
+			for name, want := range tt.wantHeader {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes used by the proxy (see grpc/codes).
+const (
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcPermissionDenied = 7
+	grpcResourceExhaust  = 8
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcServiceMethod splits a gRPC path "/package.Service/Method".
+func grpcServiceMethod(path string) (service, method string, ok bool) {
+	path, found := strings.CutPrefix(path, "/")
+	if !found {
+		return "", "", false
+	}
+	service, method, ok = strings.Cut(path, "/")
+	return service, method, ok && service != "" && method != "" && !strings.Contains(method, "/")
+}
+
+// writeGRPCError sends a trailers-only gRPC response, which is how gRPC
+// clients expect to learn that a call failed before reaching a server.
+func writeGRPCError(w http.ResponseWriter, code int, msg string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	h.Set("Grpc-Message", msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcCodeForHTTP maps an HTTP status from a server that did not answer with
+// gRPC status itself, following the gRPC HTTP to gRPC status mapping.
+func grpcCodeForHTTP(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcInternal
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return grpcUnavailable
+	}
+	return grpcUnknown
+}
+
+// grpcCodeForError maps a failed upstream round trip to a gRPC status.
+func grpcCodeForError(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return grpcDeadlineExceeded
+	}
+	return grpcUnavailable
+}
+
+// grpcCodeForStatus converts the HTTP status the proxy would have sent for
+// its own failures.
+func grpcCodeForStatus(status int) int {
+	switch status {
+	case http.StatusNotFound:
+		return grpcUnimplemented
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusTooManyRequests:
+		return grpcResourceExhaust
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return grpcUnavailable
+	}
+	return grpcCodeForHTTP(status)
+}
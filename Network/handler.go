@@ -1,8 +1,6 @@
 package network
 
 import (
-	"bufio"
-	"bytes"
 	"io"
 	"log"
 	"net"
@@ -10,84 +8,336 @@ import (
 	"strings"
 	"time"
 
-	algorithm "github.com/Faizan2005/Balancer"
+	backend "github.com/Faizan2005/Backend"
 )
 
-func (lb *LBProperties) HandleHTTP(peekReader *bufio.Reader, conn net.Conn) {
-	defer conn.Close()
+// Hop-by-hop headers are meaningful only for a single connection and are not
+// forwarded (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func (lb *LBProperties) l7Handler(t *TCPTransport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lb.proxyRequest(t, w, r)
+	})
+}
+
+func (lb *LBProperties) proxyRequest(t *TCPTransport, w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	log.Println("[HTTP_HANDLER] New HTTP connection received.")
+	log.Printf("[HTTP_HANDLER] %s %s %s from %s", r.Proto, r.Method, r.URL.Path, r.RemoteAddr)
 
-	// Capture buffered data and prepend it to the rest of the stream
-	peeked, err := peekReader.Peek(peekReader.Buffered())
-	if err != nil {
-		log.Printf("[HTTP_HANDLER] Error peeking buffered data: %v", err)
+	route, poolName := lb.l7For(t).route(r, t.DefaultPool)
+	if route != nil && !route.ACL.Allows(r.RemoteAddr) {
+		writeError(w, r, http.StatusForbidden, "forbidden")
 		return
 	}
-	reader := io.MultiReader(bytes.NewReader(peeked), peekReader)
 
-	// Parse HTTP request for routing
-	req, err := http.ReadRequest(bufio.NewReader(reader))
-	if err != nil {
-		log.Printf("[HTTP_HANDLER] Error parsing HTTP request: %v", err)
+	if route.direct() {
+		if allowRequest(w, r, route, t.requestLimiter) {
+			route.respondDirect(w, r)
+		}
 		return
 	}
 
-	path := req.URL.Path
-	urlType := ClassifyURLRequest(path)
-	pool := lb.L7LBProperties.L7Pools[urlType]
-	if pool == nil {
-		log.Printf("[HTTP_HANDLER] No server pool found for URL type: %s", urlType)
+	if route != nil && route.Split != nil {
+		poolName = route.Split.pick(w, r)
+	}
+	balancer := lb.Balancers[poolName]
+	if balancer == nil {
+		log.Printf("[HTTP_HANDLER] No server pool found for %s", r.URL.Path)
+		writeError(w, r, http.StatusNotFound, "no route")
 		return
 	}
 
-	l7Adapter := algorithm.L7PoolAdapter{pool}
-	algoName := algorithm.SelectAlgoL7(&l7Adapter)
-	if algoName == "" {
-		log.Println("[HTTP_HANDLER] No algorithm selected for L7 request")
+	if !allowRequest(w, r, route, t.requestLimiter, balancer.Pool.Limiter) {
 		return
 	}
 
-	server := algorithm.ApplyAlgo(&l7Adapter, algoName, lb.AlgorithmsMap)
-	if server == nil {
-		log.Println("[HTTP_HANDLER] No server returned by algorithm")
+	upgrade := upgradeType(r.Header)
+	if r.ProtoMajor != 1 {
+		upgrade = "" // Upgrade is an HTTP/1.1 mechanism
+	}
+	if route != nil && upgrade == "" {
+		lb.mirror(t, route, r)
+	}
+
+	write := func(resp *http.Response) {
+		writeResponse(w, resp, t.compressionFor(route).encodingFor(r, resp))
+		log.Printf("[HTTP_HANDLER] %s %s -> %d in %v", r.Method, r.URL.Path, resp.StatusCode, time.Since(startTime))
+	}
+
+	if cache := lb.l7For(t).cacheFor(poolName); cache != nil && upgrade == "" && cacheableRequest(r) {
+		cache.serve(w, r, func(conditional http.Header) (*http.Response, func()) {
+			return lb.forward(t, w, r, route, poolName, "", conditional)
+		}, write)
+		return
+	}
+
+	resp, done := lb.forward(t, w, r, route, poolName, upgrade, nil)
+	if resp == nil {
 		return
 	}
+	defer done()
 
-	log.Printf("[HTTP_HANDLER] Selected backend: %s", server.GetAddress())
+	if resp.StatusCode == http.StatusSwitchingProtocols && upgrade != "" {
+		// The upgraded connection counts against the server until it closes.
+		handleUpgrade(t, w, r, resp)
+		return
+	}
 
-	// Update server connection count
-	server.Lock()
-	server.SetConnCount(server.GetConnCount() + 1)
-	server.Unlock()
+	write(resp)
+}
 
-	backendConn, err := net.Dial("tcp", server.GetAddress())
+// forward sends r to a server from poolName and returns the response, with a
+// func that closes it and releases the server once it has been written. If
+// the request fails, forward answers the client itself and returns nil. A
+// non-nil conditional replaces the client's If-None-Match and
+// If-Modified-Since headers, for cache revalidation.
+func (lb *LBProperties) forward(t *TCPTransport, w http.ResponseWriter, r *http.Request, route *Route, poolName, upgrade string, conditional http.Header) (*http.Response, func()) {
+	balancer := lb.Balancers[poolName]
+	server, err := balancer.Acquire(r.Context())
 	if err != nil {
-		log.Printf("[HTTP_HANDLER] Failed to connect to backend %s: %v", server.GetAddress(), err)
-		return
+		log.Printf("[HTTP_HANDLER] No server in pool %s: %v", poolName, err)
+		writeError(w, r, http.StatusServiceUnavailable, "no healthy upstream")
+		return nil, nil
 	}
-	defer backendConn.Close()
+	// The request counts against the server until it completes.
+	release := func() { balancer.Release(server) }
 
-	// Reuse reader for forwarding (request already parsed)
-	go func() {
-		_, err := io.Copy(backendConn, reader)
-		if err != nil {
-			log.Printf("[HTTP_HANDLER] Error copying client → backend: %v", err)
+	routeName := "-"
+	if route != nil {
+		routeName = route.Name
+	}
+	log.Printf("[HTTP_HANDLER] Route %s, pool %s, selected backend: %s", routeName, poolName, server.GetAddress())
+
+	out := outboundRequest(r, server, upgrade, route.rewrite())
+	if conditional != nil {
+		out.Header.Del("If-None-Match")
+		out.Header.Del("If-Modified-Since")
+		for name, values := range conditional {
+			out.Header[name] = values
 		}
-	}()
+	}
 
-	_, err = io.Copy(conn, backendConn)
+	// Upgrades need an HTTP/1.1 upstream connection to take over.
+	transport := lb.upstreamTransport(balancer.Pool, server, upgrade != "", t.Timeouts)
+	upstreamStart := time.Now()
+	resp, err := transport.RoundTrip(out)
+	// A client that went away says nothing about the server.
+	failed := err != nil && r.Context().Err() == nil || err == nil && resp.StatusCode >= http.StatusInternalServerError
+	server.Report(!failed, time.Since(upstreamStart))
 	if err != nil {
+		release()
+		log.Printf("[HTTP_HANDLER] Request to backend %s failed: %v", server.GetAddress(), err)
+		if isGRPC(r) {
+			writeGRPCError(w, grpcCodeForError(err), "upstream unavailable: "+err.Error())
+		} else {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+		return nil, nil
+	}
+	// Held apart from resp, as handleUpgrade clears resp.Body to write the 101.
+	body := resp.Body
+	done := func() {
+		body.Close()
+		release()
+	}
+
+	// A gRPC call answered with a plain HTTP error (e.g. a proxy or a non-gRPC
+	// server) still has to end with a gRPC status for the client.
+	if isGRPC(r) && resp.StatusCode != http.StatusOK && resp.Header.Get("Grpc-Status") == "" {
+		done()
+		log.Printf("[HTTP_HANDLER] gRPC call to %s got HTTP %d", server.GetAddress(), resp.StatusCode)
+		writeGRPCError(w, grpcCodeForHTTP(resp.StatusCode), "upstream returned HTTP "+resp.Status)
+		return nil, nil
+	}
+
+	route.rewrite().rewriteResponse(resp.Header)
+	return resp, done
+}
+
+// writeError reports a failure produced by the proxy itself, as a gRPC status
+// for gRPC calls and a plain HTTP error otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if isGRPC(r) {
+		writeGRPCError(w, grpcCodeForStatus(status), msg)
+		return
+	}
+	http.Error(w, msg, status)
+}
+
+// outboundRequest builds the request sent to server from the client's request.
+// upgrade is the protocol being switched to, or "" for a normal request, and
+// rewrite the route's transforms, if any.
+func outboundRequest(r *http.Request, server *backend.Server, upgrade string, rewrite *RewriteOpts) *http.Request {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.URL.Host = server.HostPort()
+	out.URL.Scheme = "http"
+	if server.TLS != nil {
+		out.URL.Scheme = "https"
+	}
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	removeHopHeaders(out.Header)
+	if upgrade != "" {
+		out.Header.Set("Connection", "Upgrade")
+		out.Header.Set("Upgrade", upgrade)
+	}
+	// gRPC and other trailer-aware clients need TE: trailers to reach the server.
+	if strings.Contains(strings.ToLower(r.Header.Get("Te")), "trailers") {
+		out.Header.Set("Te", "trailers")
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+	out.Header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		out.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		out.Header.Set("X-Forwarded-Proto", "http")
+	}
+
+	rewrite.rewriteRequest(out)
+	return out
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, field := range h.Values("Connection") {
+		for _, name := range strings.Split(field, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// writeResponse copies the backend response to the client, flushing as it
+// goes for streamed bodies and forwarding trailers. A non-empty encoding
+// compresses the body with it.
+func writeResponse(w http.ResponseWriter, resp *http.Response, encoding string) {
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	var compressed *compressWriter
+	body := w
+	if encoding != "" {
+		compressed = startCompression(w, encoding)
+		body = compressed
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	streaming := resp.ContentLength < 0
+	if err := copyBody(body, resp.Body, streaming); err != nil {
 		log.Printf("[HTTP_HANDLER] Error copying backend → client: %v", err)
 	}
+	if compressed != nil {
+		compressed.Close()
+	}
 
-	log.Printf("[HTTP_HANDLER] TCP forwarding done for path %s", path)
-	log.Printf("[HTTP_HANDLER] Total time taken: %v", time.Since(startTime))
+	for name, values := range resp.Trailer {
+		w.Header()[http.TrailerPrefix+name] = values
+	}
+}
 
-	// Decrement server connection count
-	server.Lock()
-	server.SetConnCount(server.GetConnCount() - 1)
-	server.Unlock()
+func copyBody(w http.ResponseWriter, body io.Reader, flush bool) error {
+	controller := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flush {
+				controller.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type upstreamKey struct {
+	server   *backend.Server
+	http1    bool
+	timeouts TimeoutOpts
+}
+
+// upstreamTransport returns the transport for server, forced to HTTP/1.1 when
+// http1 is set (for upgrades) even if the pool speaks HTTP/2. Connect bounds
+// dialing and the TLS handshake, Response the wait for response headers.
+func (lb *LBProperties) upstreamTransport(pool *backend.Pool, server *backend.Server, http1 bool, timeouts TimeoutOpts) *http.Transport {
+	key := upstreamKey{server: server, http1: http1 || !pool.HTTP2, timeouts: timeouts}
+	if tr, ok := lb.upstreamTransports.Load(key); ok {
+		return tr.(*http.Transport)
+	}
+
+	protocols := new(http.Protocols)
+	switch {
+	case key.http1:
+		protocols.SetHTTP1(true)
+	case server.TLS != nil:
+		protocols.SetHTTP2(true)
+	default:
+		protocols.SetUnencryptedHTTP2(true)
+	}
+
+	tr := &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: timeouts.Connect}).DialContext,
+		TLSHandshakeTimeout:   timeouts.Connect,
+		ResponseHeaderTimeout: timeouts.Response,
+		TLSClientConfig:       server.TLS,
+		Protocols:             protocols,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	actual, _ := lb.upstreamTransports.LoadOrStore(key, tr)
+	return actual.(*http.Transport)
+}
+
+// pruneTransports drops the upstream transports of servers that are no longer
+// in any pool, closing their idle connections. Requests still running on them
+// finish normally.
+func (p *LBProperties) pruneTransports() {
+	live := make(map[*backend.Server]bool)
+	for _, pool := range p.Pools {
+		for _, s := range pool.Snapshot().Servers {
+			live[s] = true
+		}
+	}
+
+	p.upstreamTransports.Range(func(key, tr any) bool {
+		if !live[key.(upstreamKey).server] {
+			p.upstreamTransports.Delete(key)
+			tr.(*http.Transport).CloseIdleConnections()
+		}
+		return true
+	})
 }
 
 func ClassifyURLRequest(path string) string {
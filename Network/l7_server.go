@@ -0,0 +1,112 @@
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connListener is a net.Listener fed by the sniffer, so connections it has
+// classified as HTTP can be served by a regular http.Server.
+type connListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr { return l.addr }
+
+func (l *connListener) push(conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.closed:
+		return net.ErrClosed
+	}
+}
+
+// bufferedConn replays the bytes the sniffer peeked before reading from the
+// connection itself.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.reader.Read(b) }
+
+// startL7 creates the HTTP server for a listener. It serves HTTP/1.x and h2c
+// prior knowledge on plaintext connections, and h2 or HTTP/1.1 (by ALPN) on
+// connections whose TLS the listener terminates.
+func (p *LBProperties) startL7(t *TCPTransport) {
+	t.l7Listener = newConnListener(t.Listener.Addr())
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	t.l7Server = &http.Server{
+		Handler:           p.l7Handler(t),
+		Protocols:         protocols,
+		ReadHeaderTimeout: t.Timeouts.Handshake, // Also bounds the TLS handshake
+		IdleTimeout:       t.Timeouts.Idle,
+	}
+
+	go func() {
+		err := t.l7Server.Serve(t.l7Listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Printf("[HTTP_HANDLER] L7 server on %s stopped: %v", t.ListenAddr, err)
+		}
+	}()
+}
+
+// HandleHTTP hands a plaintext HTTP/1.x or h2c connection to the listener's
+// L7 server, which routes every request (or HTTP/2 stream) on its own.
+func (p *LBProperties) HandleHTTP(t *TCPTransport, reader *bufio.Reader, conn net.Conn) {
+	if err := t.l7Listener.push(&bufferedConn{Conn: conn, reader: reader}); err != nil {
+		log.Printf("[HTTP_HANDLER] Dropping connection from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+	}
+}
+
+// HandleTLS terminates TLS with the listener's certificate and serves the
+// connection as L7, negotiating h2 or HTTP/1.1 with ALPN.
+func (p *LBProperties) HandleTLS(t *TCPTransport, reader *bufio.Reader, conn net.Conn) {
+	config := t.TLS.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	tlsConn := tls.Server(&bufferedConn{Conn: conn, reader: reader}, config)
+	if err := t.l7Listener.push(tlsConn); err != nil {
+		log.Printf("[HTTP_HANDLER] Dropping TLS connection from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+	}
+}
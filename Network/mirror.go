@@ -0,0 +1,96 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMirrorMaxBody = 64 << 10
+	// mirrorTimeout bounds a shadow request, which no client is waiting for.
+	mirrorTimeout = 30 * time.Second
+)
+
+// MirrorOpts copies a share of a route's requests to a shadow pool. Shadow
+// requests run in the background and their responses are discarded, so they
+// never affect the client.
+type MirrorOpts struct {
+	Pool    string
+	Percent float64 // Share of requests to copy, 0-100
+	// MaxBodyBytes is the largest request body mirrored, defaults to 64KiB.
+	// Requests with larger bodies, or streamed ones of unknown length, are not
+	// mirrored.
+	MaxBodyBytes int64
+}
+
+// mirror sends a copy of r to the route's shadow pool if it is sampled. The
+// body is buffered up to the limit and r.Body replaced so the primary request
+// still reads all of it.
+func (lb *LBProperties) mirror(t *TCPTransport, route *Route, r *http.Request) {
+	opts := route.Mirror
+	if opts == nil || rand.Float64()*100 >= opts.Percent {
+		return
+	}
+
+	balancer := lb.Balancers[opts.Pool]
+	if balancer == nil {
+		return
+	}
+
+	limit := opts.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMirrorMaxBody
+	}
+
+	var body []byte
+	if r.Body != nil && r.ContentLength != 0 {
+		// A streamed body of unknown length (e.g. a gRPC stream) can run for
+		// as long as the call, so buffering it would stall the primary.
+		if r.ContentLength < 0 || r.ContentLength > limit {
+			return
+		}
+		buffered, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buffered), r.Body), r.Body}
+		if err != nil || int64(len(buffered)) > limit {
+			return
+		}
+		body = buffered
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	shadow := r.Clone(ctx)
+	shadow.ContentLength = int64(len(body))
+	shadow.Body = io.NopCloser(bytes.NewReader(body))
+
+	go func() {
+		defer cancel()
+
+		server, err := balancer.Acquire(ctx)
+		if err != nil {
+			log.Printf("[MIRROR] No server in pool %s: %v", opts.Pool, err)
+			return
+		}
+		defer balancer.Release(server)
+
+		start := time.Now()
+		transport := lb.upstreamTransport(balancer.Pool, server, false, t.Timeouts)
+		resp, err := transport.RoundTrip(outboundRequest(shadow, server, "", route.Rewrite))
+		server.Report(err == nil && resp.StatusCode < http.StatusInternalServerError, time.Since(start))
+		if err != nil {
+			log.Printf("[MIRROR] %s %s to %s failed: %v", r.Method, r.URL.Path, server.GetAddress(), err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		log.Printf("[MIRROR] %s %s to %s -> %d in %v", r.Method, r.URL.Path, server.GetAddress(), resp.StatusCode, time.Since(start))
+	}()
+}
@@ -0,0 +1,118 @@
+package network
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// closeWriter is implemented by connections that support half-close, such as
+// *net.TCPConn and *tls.Conn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// closeWrite signals EOF to the peer while still reading from it. Connections
+// that cannot half-close are left open; the other direction ends them.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(closeWriter); ok {
+		cw.CloseWrite()
+	}
+}
+
+// pipe relays bytes between a client and an upstream connection until both
+// directions have finished. EOF on one side is propagated as a half-close to
+// the other, so protocols that shut down one direction first still complete.
+// Both connections are closed if either direction fails, if neither carries
+// traffic for idle, or once lifetime has passed. Zero durations disable the
+// corresponding limit. clientReader replaces reads from client, so sniffed
+// bytes are sent first.
+func pipe(client net.Conn, clientReader io.Reader, upstream net.Conn, idle, lifetime time.Duration) {
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			client.Close()
+			upstream.Close()
+		})
+	}
+	defer closeBoth()
+
+	if lifetime > 0 {
+		timer := time.AfterFunc(lifetime, closeBoth)
+		defer timer.Stop()
+	}
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
+	errc := make(chan error, 2)
+	go func() { errc <- relayHalf(upstream, clientReader, client, idle, &lastActive) }()
+	go func() { errc <- relayHalf(client, upstream, upstream, idle, &lastActive) }()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			closeBoth()
+		}
+	}
+}
+
+// relayHalf copies src to dst until src reaches EOF, then half-closes dst.
+// srcConn is the connection behind src, used for idle deadlines. A read that
+// times out only fails if the other direction has been idle as well.
+func relayHalf(dst net.Conn, src io.Reader, srcConn net.Conn, idle time.Duration, lastActive *atomic.Int64) error {
+	buf := make([]byte, 32*1024)
+
+	for {
+		if idle > 0 {
+			srcConn.SetReadDeadline(time.Now().Add(idle))
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			lastActive.Store(time.Now().UnixNano())
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			closeWrite(dst)
+			return nil
+		case errors.Is(err, os.ErrDeadlineExceeded) && time.Since(time.Unix(0, lastActive.Load())) < idle:
+			// The other direction is still active
+		default:
+			return err
+		}
+	}
+}
+
+// lifetimeConn closes itself once its maximum lifetime has passed.
+type lifetimeConn struct {
+	net.Conn
+	timer *time.Timer
+}
+
+func limitLifetime(conn net.Conn, lifetime time.Duration) net.Conn {
+	if lifetime <= 0 {
+		return conn
+	}
+	return &lifetimeConn{Conn: conn, timer: time.AfterFunc(lifetime, func() { conn.Close() })}
+}
+
+func (c *lifetimeConn) Close() error {
+	c.timer.Stop()
+	return c.Conn.Close()
+}
+
+func (c *lifetimeConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
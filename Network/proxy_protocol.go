@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxiedConn reports the client address carried in a PROXY protocol header
+// instead of the address of the proxy in front of us.
+type proxiedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *proxiedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// readProxyHeader consumes a PROXY protocol v1 or v2 header from reader and
+// returns conn wrapped with the original client address. LOCAL (health check)
+// and UNKNOWN headers keep the connection's own address.
+func readProxyHeader(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	head, err := reader.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(head, proxyV2Signature) {
+		return readProxyV2(conn, reader)
+	}
+	return readProxyV1(conn, reader)
+}
+
+func readProxyV1(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	// The spec caps a v1 line at 107 bytes including CRLF.
+	line, err := reader.ReadSlice('\n')
+	if err != nil || len(line) > 107 {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+
+	fields := strings.Fields(strings.TrimRight(string(line), "\r\n"))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return conn, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("malformed PROXY v1 source %s:%s", fields[2], fields[4])
+	}
+
+	return &proxiedConn{Conn: conn, remote: &net.TCPAddr{IP: ip, Port: int(port)}}, nil
+}
+
+func readProxyV2(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	family := header[13] >> 4
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	if command > 1 {
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", command)
+	}
+	if command == 0 { // LOCAL
+		return conn, nil
+	}
+
+	switch {
+	case family == 1 && length >= 12: // AF_INET
+		return &proxiedConn{Conn: conn, remote: &net.TCPAddr{
+			IP:   net.IP(body[0:4]),
+			Port: int(binary.BigEndian.Uint16(body[8:10])),
+		}}, nil
+	case family == 2 && length >= 36: // AF_INET6
+		return &proxiedConn{Conn: conn, remote: &net.TCPAddr{
+			IP:   net.IP(body[0:16]),
+			Port: int(binary.BigEndian.Uint16(body[32:34])),
+		}}, nil
+	}
+
+	return conn, nil
+}
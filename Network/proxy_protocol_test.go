@@ -0,0 +1,144 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+// proxiedGet sends a PROXY v1 header for client followed by a GET and returns
+// the status, or 0 if the connection was refused.
+func proxiedGet(t *testing.T, lb *LBProperties, client string) int {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", lb.Transports[0].Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "PROXY TCP4 "+client+" 192.0.2.1 40000 80\r\n")
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: lb\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestTrustedProxyClientChecks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	acl, err := NewACL("edge", ACLOpts{Deny: []string{"203.0.113.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb := startTestLB(t, TransportOpts{
+		Mode:           ModeAuto,
+		TrustedProxies: []string{"127.0.0.1"},
+		ACL:            acl,
+		ConnRateLimit:  backend.RateLimitOpts{Rate: 0.001, Burst: 1},
+	}, backend.NewServer(backend.ServerOpts{Address: upstream.Listener.Addr().String(), Weight: 1}))
+
+	tests := []struct {
+		client string
+		want   int
+	}{
+		{"198.51.100.1", http.StatusOK},
+		{"198.51.100.2", http.StatusOK}, // Same proxy, another client's bucket
+		{"198.51.100.1", 0},             // Rate limited by the client's address
+		{"203.0.113.7", 0},              // Denied by the ACL
+	}
+	for _, tt := range tests {
+		if got := proxiedGet(t, lb, tt.client); got != tt.want {
+			t.Errorf("client %s: status %d, want %d", tt.client, got, tt.want)
+		}
+	}
+}
+
+// proxyV2 builds a PROXY v2 header with command and family bytes and body.
+func proxyV2(verCmd, family byte, body []byte) string {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, verCmd, family, byte(len(body)>>8), byte(len(body)))
+	return string(append(header, body...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4 := []byte{198, 51, 100, 7, 192, 0, 2, 1, 0x9c, 0x40, 0, 80}
+	ipv6 := make([]byte, 36)
+	copy(ipv6, net.ParseIP("2001:db8::7"))
+	copy(ipv6[16:], net.ParseIP("2001:db8::1"))
+	ipv6[32], ipv6[33] = 0x9c, 0x40
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string // Remote address, "" if the connection's own
+		wantErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 198.51.100.7 192.0.2.1 40000 80\r\n", "198.51.100.7:40000", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::7 2001:db8::1 40000 80\r\n", "[2001:db8::7]:40000", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"v1 unknown with addresses", "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n", "", false},
+		{"v1 bad protocol", "PROXY UDP4 198.51.100.7 192.0.2.1 40000 80\r\n", "", true},
+		{"v1 missing field", "PROXY TCP4 198.51.100.7 192.0.2.1 40000\r\n", "", true},
+		{"v1 bad address", "PROXY TCP4 198.51.100 192.0.2.1 40000 80\r\n", "", true},
+		{"v1 bad port", "PROXY TCP4 198.51.100.7 192.0.2.1 port 80\r\n", "", true},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::7 192.0.2.1 40000 80\r\n", "", true},
+		{"v1 port out of range", "PROXY TCP4 198.51.100.7 192.0.2.1 70000 80\r\n", "", true},
+		{"v1 too long", "PROXY TCP4 " + strings.Repeat("1", 100) + "\r\n", "", true},
+		{"v1 no newline", "PROXY TCP4 198.51.100.7", "", true},
+		{"v2 ipv4", proxyV2(0x21, 0x11, ipv4), "198.51.100.7:40000", false},
+		{"v2 ipv6", proxyV2(0x21, 0x21, ipv6), "[2001:db8::7]:40000", false},
+		{"v2 local", proxyV2(0x20, 0x11, ipv4), "", false},
+		{"v2 unspecified family", proxyV2(0x21, 0x00, nil), "", false},
+		{"v2 with TLVs", proxyV2(0x21, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0xff)), "198.51.100.7:40000", false},
+		{"v2 short ipv4", proxyV2(0x21, 0x11, ipv4[:8]), "", false},
+		{"v2 bad version", proxyV2(0x11, 0x11, ipv4), "", true},
+		{"v2 bad command", proxyV2(0x2f, 0x11, ipv4), "", true},
+		{"v2 truncated", proxyV2(0x21, 0x11, ipv4)[:20], "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, peer := net.Pipe()
+			defer conn.Close()
+			defer peer.Close()
+
+			reader := bufio.NewReader(strings.NewReader(tt.input + "payload"))
+			got, err := readProxyHeader(conn, reader)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got.RemoteAddr())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.want == "" {
+				if got != conn {
+					t.Errorf("remote = %v, want the connection's own", got.RemoteAddr())
+				}
+			} else if got.RemoteAddr().String() != tt.want {
+				t.Errorf("remote = %v, want %s", got.RemoteAddr(), tt.want)
+			}
+
+			// Whatever follows the header is left for the sniffer.
+			if rest, _ := io.ReadAll(reader); string(rest) != "payload" {
+				t.Errorf("left %q after the header, want payload", rest)
+			}
+		})
+	}
+}
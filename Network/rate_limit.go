@@ -0,0 +1,74 @@
+package network
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+// allowConn applies a connection rate limit to a new L4 connection. Only the
+// client IP is known at that point, so every key type counts per IP.
+func allowConn(limiter *backend.RateLimiter, conn net.Conn) bool {
+	if limiter == nil {
+		return true
+	}
+
+	ip := clientIP(conn.RemoteAddr().String())
+	if ok, _ := limiter.Allow(ip, time.Now()); !ok {
+		log.Printf("[RATE_LIMIT] Refusing connection from %s", conn.RemoteAddr())
+		return false
+	}
+	return true
+}
+
+// allowRequest applies the given limiters to an L7 request in order and
+// answers 429 with Retry-After if any of them is exhausted.
+func allowRequest(w http.ResponseWriter, r *http.Request, route *Route, limiters ...*backend.RateLimiter) bool {
+	now := time.Now()
+
+	for _, limiter := range limiters {
+		if limiter == nil {
+			continue
+		}
+
+		ok, wait := limiter.Allow(requestLimitKey(limiter, r, route), now)
+		if ok {
+			continue
+		}
+
+		log.Printf("[RATE_LIMIT] Limiting %s %s from %s, retry in %v", r.Method, r.URL.Path, r.RemoteAddr, wait)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+func requestLimitKey(limiter *backend.RateLimiter, r *http.Request, route *Route) string {
+	switch limiter.Key {
+	case backend.RateLimitByHeader:
+		if v := r.Header.Get(limiter.Header); v != "" {
+			return "header:" + v
+		}
+	case backend.RateLimitByRoute:
+		if route != nil {
+			return "route:" + route.Name
+		}
+		return "route:-"
+	}
+	return "ip:" + clientIP(r.RemoteAddr)
+}
+
+// clientIP strips the port from a remote address.
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,93 @@
+package network
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderRewrite edits a header set. Remove runs first, then Set replaces any
+// existing values and Add appends to them.
+type HeaderRewrite struct {
+	Remove []string
+	Set    map[string]string
+	Add    map[string]string
+}
+
+func (h HeaderRewrite) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
+
+// RewriteOpts transforms requests on their way to the backend and responses
+// on their way back.
+type RewriteOpts struct {
+	// StripPrefix is removed from the start of the path and ReplacePrefix
+	// put in its place, e.g. "/api/v2" and "" turn "/api/v2/users" into
+	// "/users". The prefix must end at a segment boundary, so "/api/v2beta"
+	// and other paths without it are left alone.
+	StripPrefix   string
+	ReplacePrefix string
+	Host          string // Host header sent upstream, the client's if empty
+	Request       HeaderRewrite
+	Response      HeaderRewrite
+}
+
+func (route *Route) rewrite() *RewriteOpts {
+	if route == nil {
+		return nil
+	}
+	return route.Rewrite
+}
+
+// rewriteRequest applies the request transforms to an outbound request.
+func (o *RewriteOpts) rewriteRequest(out *http.Request) {
+	if o == nil {
+		return
+	}
+
+	if o.StripPrefix != "" {
+		if path, ok := o.replacePrefix(out.URL.Path); ok {
+			out.URL.Path = path
+			// Keep escapes such as %2F that Path cannot express. If RawPath
+			// no longer matches, it is re-encoded from Path.
+			out.URL.RawPath, _ = o.replacePrefix(out.URL.RawPath)
+		}
+	}
+
+	if o.Host != "" {
+		out.Host = o.Host
+	}
+
+	o.Request.apply(out.Header)
+}
+
+// replacePrefix swaps StripPrefix for ReplacePrefix at the start of path. It
+// reports false, returning "", if path does not start with the prefix followed
+// by a segment boundary.
+func (o *RewriteOpts) replacePrefix(path string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, o.StripPrefix)
+	if !ok || rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasSuffix(o.StripPrefix, "/") {
+		return "", false
+	}
+
+	path = o.ReplacePrefix + rest
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path, true
+}
+
+// rewriteResponse applies the response header transforms.
+func (o *RewriteOpts) rewriteResponse(header http.Header) {
+	if o == nil {
+		return
+	}
+	o.Response.apply(header)
+}
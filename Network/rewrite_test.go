@@ -0,0 +1,88 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestReplacePrefix(t *testing.T) {
+	tests := []struct {
+		strip, replace string
+		path           string
+		want           string
+		wantOK         bool
+	}{
+		{"/api/v2", "", "/api/v2/users", "/users", true},
+		{"/api/v2", "", "/api/v2", "/", true},
+		{"/api/v2", "/v3", "/api/v2/users", "/v3/users", true},
+		{"/api/v2", "v3", "/api/v2/users", "/v3/users", true},
+		{"/api/v2", "", "/api/v2beta/x", "", false},
+		{"/api/v2", "", "/api/v", "", false},
+		{"/api/v2", "", "/other/api/v2", "", false},
+		{"/api/", "", "/api/users", "/users", true},
+		{"/api/", "/internal/", "/api/users", "/internal/users", true},
+		{"/api/v2", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		o := &RewriteOpts{StripPrefix: tt.strip, ReplacePrefix: tt.replace}
+		got, ok := o.replacePrefix(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("strip %q replace %q on %q: got %q, %v; want %q, %v", tt.strip, tt.replace, tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRewriteRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        *RewriteOpts
+		target      string
+		wantPath    string
+		wantEscaped string
+		wantHost    string
+	}{
+		{"nil options", nil, "/api/v2/users", "/api/v2/users", "/api/v2/users", "example.com"},
+		{"strip", &RewriteOpts{StripPrefix: "/api/v2"}, "/api/v2/users", "/users", "/users", "example.com"},
+		{"segment boundary", &RewriteOpts{StripPrefix: "/api/v2"}, "/api/v2beta/x", "/api/v2beta/x", "/api/v2beta/x", "example.com"},
+		{"escaped slash kept", &RewriteOpts{StripPrefix: "/api/v2", ReplacePrefix: "/v3"}, "/api/v2/a%2Fb", "/v3/a/b", "/v3/a%2Fb", "example.com"},
+		{"host", &RewriteOpts{Host: "internal.svc"}, "/", "/", "/", "internal.svc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.target, nil)
+			tt.opts.rewriteRequest(r)
+
+			if r.URL.Path != tt.wantPath || r.URL.EscapedPath() != tt.wantEscaped {
+				t.Errorf("path = %q (%q), want %q (%q)", r.URL.Path, r.URL.EscapedPath(), tt.wantPath, tt.wantEscaped)
+			}
+			if r.Host != tt.wantHost {
+				t.Errorf("host = %q, want %q", r.Host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestHeaderRewrite(t *testing.T) {
+	h := http.Header{
+		"X-Internal": {"secret"},
+		"X-Version":  {"1"},
+		"Via":        {"edge"},
+	}
+	HeaderRewrite{
+		Remove: []string{"x-internal"},
+		Set:    map[string]string{"X-Version": "2"},
+		Add:    map[string]string{"Via": "lb"},
+	}.apply(h)
+
+	want := http.Header{
+		"X-Version": {"2"},
+		"Via":       {"edge", "lb"},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %v, want %v", h, want)
+	}
+}
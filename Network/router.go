@@ -0,0 +1,135 @@
+package network
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RouteMatch holds the conditions a request must meet for a route to apply.
+// Empty fields match anything.
+type RouteMatch struct {
+	Host       string            // Host without port, e.g. "api.example.com"
+	PathPrefix string            // e.g. "/api/"
+	Methods    []string          // e.g. GET, POST
+	Headers    map[string]string // Exact header values
+	// GRPCService and GRPCMethod match gRPC calls by their
+	// "/package.Service/Method" path; setting either limits the route to gRPC.
+	GRPCService string // e.g. "helloworld.Greeter"
+	GRPCMethod  string // e.g. "SayHello"
+}
+
+func (m RouteMatch) Matches(r *http.Request) bool {
+	if m.Host != "" && !strings.EqualFold(m.Host, requestHost(r)) {
+		return false
+	}
+
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+
+	if len(m.Methods) > 0 {
+		found := false
+		for _, method := range m.Methods {
+			if strings.EqualFold(method, r.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for name, value := range m.Headers {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	if m.GRPCService != "" || m.GRPCMethod != "" {
+		service, method, ok := grpcServiceMethod(r.URL.Path)
+		if !ok || !isGRPC(r) {
+			return false
+		}
+		if m.GRPCService != "" && m.GRPCService != service {
+			return false
+		}
+		if m.GRPCMethod != "" && m.GRPCMethod != method {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Route sends requests matching Match to Pool, or across several pools when
+// Split is set. Routes with Redirect or Respond answer requests themselves
+// and need no pool. With an ACL, matching requests from addresses it does not
+// allow get 403 instead of trying later routes, so e.g. admin paths can be
+// limited to internal ranges.
+type Route struct {
+	Name     string
+	Match    RouteMatch
+	Pool     string
+	Split    *TrafficSplit
+	Mirror   *MirrorOpts  // Shadow a share of the requests to another pool
+	Rewrite  *RewriteOpts // Path, host and header transforms
+	Redirect *RedirectOpts
+	Respond  *DirectResponse
+	// Compression replaces the listener's compression options for this
+	// route, e.g. &CompressionOpts{Disabled: true}.
+	Compression *CompressionOpts
+	ACL         *ACL
+}
+
+// L7LBProperties is the L7 router. Routes are tried in order; requests no
+// route matches are classified by ClassifyURLRequest and looked up in L7Pools,
+// then fall back to the listener's default pool.
+type L7LBProperties struct {
+	Routes  []*Route
+	L7Pools map[string]string // Request class to pool name
+	// Caches holds a response cache per pool name, e.g. for "static".
+	// Requests to other pools are not cached.
+	Caches map[string]*ResponseCache
+}
+
+func NewL7LBProperties(pools map[string]string, routes ...*Route) *L7LBProperties {
+	return &L7LBProperties{
+		Routes:  routes,
+		L7Pools: pools,
+	}
+}
+
+// route returns the route matching r and the pool it goes to. The route is nil
+// when the request was placed by classification or the default pool.
+func (l7 *L7LBProperties) route(r *http.Request, defaultPool string) (*Route, string) {
+	if l7 != nil {
+		for _, route := range l7.Routes {
+			if route.Match.Matches(r) {
+				return route, route.Pool
+			}
+		}
+
+		if pool, exists := l7.L7Pools[ClassifyURLRequest(r.URL.Path)]; exists {
+			return nil, pool
+		}
+	}
+
+	return nil, defaultPool
+}
+
+func (l7 *L7LBProperties) cacheFor(pool string) *ResponseCache {
+	if l7 == nil {
+		return nil
+	}
+	return l7.Caches[pool]
+}
+
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
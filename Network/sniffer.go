@@ -0,0 +1,233 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	defaultSniffTimeout = 5 * time.Second
+	maxSniffBytes       = 512
+)
+
+// Protocol names what the sniffer recognised at the start of a connection.
+type Protocol string
+
+const (
+	ProtoHTTP1   Protocol = "http1"
+	ProtoHTTP2   Protocol = "http2" // Prior-knowledge preface (h2c)
+	ProtoTLS     Protocol = "tls"
+	ProtoProxy   Protocol = "proxy" // PROXY protocol v1 or v2 header
+	ProtoUnknown Protocol = "unknown"
+)
+
+// MatchResult is a signature's verdict on the bytes seen so far.
+type MatchResult int
+
+const (
+	NoMatch MatchResult = iota
+	Match
+	NeedMore // Could still match once more bytes arrive
+)
+
+// Signature recognises one protocol from the first bytes a client sends.
+type Signature struct {
+	Protocol Protocol
+	Match    func(data []byte) MatchResult
+}
+
+// ErrSilentClient is returned by sniff when the client sent nothing before the
+// sniff timeout.
+var ErrSilentClient = errors.New("client sent no data before sniff timeout")
+
+var builtinSignatures = []Signature{
+	{Protocol: ProtoProxy, Match: matchProxyProtocol},
+	{Protocol: ProtoHTTP2, Match: matchHTTP2Preface},
+	{Protocol: ProtoHTTP1, Match: matchHTTP1},
+	{Protocol: ProtoTLS, Match: matchTLSClientHello},
+}
+
+// sniff peeks at the first bytes of conn, growing the window until a signature
+// matches, every signature has ruled itself out, or the deadline passes. A
+// client still part way through a signature at timeout is given until
+// handshake, so slow clients are not mistaken for unknown protocols. The
+// peeked bytes stay in reader for whoever handles the connection.
+func sniff(conn net.Conn, reader *bufio.Reader, timeout, handshake time.Duration, custom []Signature) (Protocol, error) {
+	if timeout <= 0 {
+		timeout = defaultSniffTimeout
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	extended := false
+
+	signatures := append(append([]Signature(nil), custom...), builtinSignatures...)
+
+	want := 1
+	for {
+		data, err := reader.Peek(want)
+		if len(data) == 0 {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return ProtoUnknown, ErrSilentClient
+			}
+			return ProtoUnknown, err
+		}
+
+		pending := false
+		for _, sig := range signatures {
+			switch sig.Match(data) {
+			case Match:
+				return sig.Protocol, nil
+			case NeedMore:
+				pending = true
+			}
+		}
+
+		if pending && !extended && handshake > timeout && errors.Is(err, os.ErrDeadlineExceeded) {
+			extended = true
+			conn.SetReadDeadline(start.Add(handshake))
+			continue
+		}
+
+		// Short or slow clients: decide with what has arrived rather than
+		// waiting forever or failing the connection.
+		if !pending || err != nil || len(data) >= maxSniffBytes {
+			return ProtoUnknown, nil
+		}
+		want = len(data) + 1
+		if buffered := reader.Buffered(); buffered > len(data) {
+			want = buffered
+		}
+	}
+}
+
+// matchPrefix matches data against a fixed prefix, asking for more bytes while
+// data is itself a prefix of it.
+func matchPrefix(data, prefix []byte) MatchResult {
+	if len(data) >= len(prefix) {
+		if bytes.HasPrefix(data, prefix) {
+			return Match
+		}
+		return NoMatch
+	}
+	if bytes.HasPrefix(prefix, data) {
+		return NeedMore
+	}
+	return NoMatch
+}
+
+var http1Methods = [][]byte{
+	[]byte("GET "), []byte("HEAD "), []byte("POST "), []byte("PUT "), []byte("DELETE "),
+	[]byte("CONNECT "), []byte("OPTIONS "), []byte("TRACE "), []byte("PATCH "),
+}
+
+func matchHTTP1(data []byte) MatchResult {
+	result := NoMatch
+	for _, m := range http1Methods {
+		switch matchPrefix(data, m) {
+		case Match:
+			return Match
+		case NeedMore:
+			result = NeedMore
+		}
+	}
+	return result
+}
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+func matchHTTP2Preface(data []byte) MatchResult {
+	return matchPrefix(data, http2Preface)
+}
+
+// matchTLSClientHello matches a TLS handshake record (0x16, version 3.x)
+// carrying a ClientHello (handshake type 1).
+func matchTLSClientHello(data []byte) MatchResult {
+	checks := []func(b byte) bool{
+		func(b byte) bool { return b == 0x16 },
+		func(b byte) bool { return b == 0x03 },
+		func(b byte) bool { return b <= 0x04 },
+		func(b byte) bool { return true }, // Record length
+		func(b byte) bool { return true },
+		func(b byte) bool { return b == 0x01 },
+	}
+
+	for i, check := range checks {
+		if i >= len(data) {
+			return NeedMore
+		}
+		if !check(data[i]) {
+			return NoMatch
+		}
+	}
+	return Match
+}
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+func matchProxyProtocol(data []byte) MatchResult {
+	v1, v2 := matchPrefix(data, proxyV1Prefix), matchPrefix(data, proxyV2Signature)
+	if v1 == Match || v2 == Match {
+		return Match
+	}
+	if v1 == NeedMore || v2 == NeedMore {
+		return NeedMore
+	}
+	return NoMatch
+}
+
+// RedisSignature recognises RESP commands as sent by Redis clients: an array
+// header such as "*3\r\n".
+var RedisSignature = Signature{
+	Protocol: "redis",
+	Match: func(data []byte) MatchResult {
+		if data[0] != '*' {
+			return NoMatch
+		}
+		for i := 1; i < len(data); i++ {
+			switch {
+			case data[i] >= '0' && data[i] <= '9':
+				continue
+			case data[i] == '\r' && i > 1:
+				return Match
+			default:
+				return NoMatch
+			}
+		}
+		return NeedMore
+	},
+}
+
+// PostgresSignature recognises a Postgres StartupMessage, SSLRequest or
+// GSSENCRequest: a 32-bit length followed by a known 32-bit code.
+var PostgresSignature = Signature{
+	Protocol: "postgres",
+	Match: func(data []byte) MatchResult {
+		if len(data) < 8 {
+			return NeedMore
+		}
+
+		length := binary.BigEndian.Uint32(data[0:4])
+		code := binary.BigEndian.Uint32(data[4:8])
+		if length < 8 || length > 10000 {
+			return NoMatch
+		}
+
+		switch code {
+		case 196608, // Protocol 3.0
+			80877103, // SSLRequest
+			80877104: // GSSENCRequest
+			return Match
+		}
+		return NoMatch
+	},
+}
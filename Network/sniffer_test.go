@@ -0,0 +1,64 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSniff(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		writes  []string // Sent with a pause longer than timeout in between
+		want    Protocol
+		wantErr error
+	}{
+		{"http1", []string{"GET / HTTP/1.1\r\n"}, ProtoHTTP1, nil},
+		{"http2 preface", []string{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"}, ProtoHTTP2, nil},
+		{"tls", []string{"\x16\x03\x01\x00\xa5\x01"}, ProtoTLS, nil},
+		{"proxy v1", []string{"PROXY TCP4 "}, ProtoProxy, nil},
+		{"proxy v2", []string{"\r\n\r\n\x00\r\nQUIT\n"}, ProtoProxy, nil},
+		{"unknown", []string{"SSH-2.0-OpenSSH\r\n"}, ProtoUnknown, nil},
+		{"silent", nil, ProtoUnknown, ErrSilentClient},
+		{"slow http1", []string{"GE", "T / HTTP/1.1\r\n"}, ProtoHTTP1, nil},
+		{"slow then unknown", []string{"GE", "X"}, ProtoUnknown, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				for i, w := range tt.writes {
+					if i > 0 {
+						time.Sleep(2 * timeout)
+					}
+					client.Write([]byte(w))
+				}
+			}()
+
+			got, err := sniff(server, bufio.NewReader(server), timeout, time.Second, nil)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("sniff = %s, %v; want %s, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSniffCustomSignature(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go client.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	custom := []Signature{{Protocol: "custom", Match: func(data []byte) MatchResult { return matchPrefix(data, []byte("GET")) }}}
+	if got, err := sniff(server, bufio.NewReader(server), time.Second, time.Second, custom); got != "custom" || err != nil {
+		t.Errorf("sniff = %s, %v; want custom before the built-in signatures", got, err)
+	}
+}
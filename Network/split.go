@@ -0,0 +1,128 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+)
+
+// SplitBackend is one side of a traffic split.
+type SplitBackend struct {
+	Pool   string
+	Weight int // Share of traffic relative to the other backends, e.g. 95 and 5
+}
+
+type TrafficSplitOpts struct {
+	Backends []SplitBackend
+	// StickyCookie names a cookie recording the pool a client was sent to,
+	// so it stays there across requests and weight changes.
+	StickyCookie string
+	// StickyHeader hashes a header (e.g. a user ID) to pick the pool, so the
+	// same value lands on the same side while the weights are unchanged.
+	// The cookie takes precedence when both are set.
+	StickyHeader string
+	// OverrideHeader lets testers pick a pool of the split by name,
+	// e.g. "X-Atlas-Pool: dynamic-canary".
+	OverrideHeader string
+}
+
+// TrafficSplit spreads a route's requests over several pools by weight, for
+// canary and blue/green releases. The weights can be changed at runtime.
+type TrafficSplit struct {
+	TrafficSplitOpts
+	backends atomic.Pointer[splitBackends]
+}
+
+type splitBackends struct {
+	list  []SplitBackend
+	total int
+}
+
+func NewTrafficSplit(opts TrafficSplitOpts) (*TrafficSplit, error) {
+	s := &TrafficSplit{TrafficSplitOpts: opts}
+	if err := s.SetWeights(opts.Backends); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetWeights replaces the backends and their weights. A pool with weight zero
+// receives only sticky clients already on it and overrides.
+func (s *TrafficSplit) SetWeights(backends []SplitBackend) error {
+	total := 0
+	for _, b := range backends {
+		if b.Weight < 0 {
+			return fmt.Errorf("split pool %s: negative weight %d", b.Pool, b.Weight)
+		}
+		total += b.Weight
+	}
+	if total == 0 {
+		return errors.New("traffic split needs a backend with a positive weight")
+	}
+
+	s.backends.Store(&splitBackends{list: append([]SplitBackend(nil), backends...), total: total})
+	log.Printf("[SPLIT] Weights set to %v", backends)
+	return nil
+}
+
+// Weights returns the current backends and weights.
+func (s *TrafficSplit) Weights() []SplitBackend {
+	return append([]SplitBackend(nil), s.backends.Load().list...)
+}
+
+// pick chooses the pool for r, setting the sticky cookie on w for clients
+// that do not have one yet.
+func (s *TrafficSplit) pick(w http.ResponseWriter, r *http.Request) string {
+	backends := s.backends.Load()
+
+	if s.OverrideHeader != "" {
+		if pool := r.Header.Get(s.OverrideHeader); pool != "" && backends.contains(pool) {
+			return pool
+		}
+	}
+
+	if s.StickyCookie != "" {
+		if cookie, err := r.Cookie(s.StickyCookie); err == nil && backends.contains(cookie.Value) {
+			return cookie.Value
+		}
+	}
+
+	var point int
+	if value := r.Header.Get(s.StickyHeader); s.StickyHeader != "" && value != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(value))
+		point = int(hash.Sum32() % uint32(backends.total))
+	} else {
+		point = rand.IntN(backends.total)
+	}
+	pool := backends.at(point)
+
+	if s.StickyCookie != "" {
+		http.SetCookie(w, &http.Cookie{Name: s.StickyCookie, Value: pool, Path: "/", HttpOnly: true})
+	}
+	return pool
+}
+
+func (b *splitBackends) contains(pool string) bool {
+	for _, backend := range b.list {
+		if backend.Pool == pool {
+			return true
+		}
+	}
+	return false
+}
+
+// at maps a point in [0, total) onto the backend owning that share.
+func (b *splitBackends) at(point int) string {
+	for _, backend := range b.list {
+		if point < backend.Weight {
+			return backend.Pool
+		}
+		point -= backend.Weight
+	}
+	return b.list[len(b.list)-1].Pool
+}
@@ -1,59 +1,304 @@
 package network
 
 import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log"
 	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
 
 	backend "github.com/Faizan2005/Backend"
 	algorithm "github.com/Faizan2005/Balancer"
 )
 
+// ProtocolMode selects how a listener treats its connections.
+type ProtocolMode string
+
+const (
+	ModeL4   ProtocolMode = "l4"   // Proxy bytes to DefaultPool without waiting for or inspecting them
+	ModeL7   ProtocolMode = "l7"   // Every connection is HTTP
+	ModeAuto ProtocolMode = "auto" // Sniff the first bytes, HTTP goes to L7, the rest to DefaultPool
+)
+
 type TransportOpts struct {
-	ListenAddr string
+	ListenAddr  string
+	Mode        ProtocolMode    // Defaults to ModeAuto
+	DefaultPool string          // Pool for L4 traffic, and L7 requests no route matches
+	L7          *L7LBProperties // L7 routing for this listener, the shared one if nil
+	Sniff       SniffOpts       // Protocol detection in ModeAuto
+	TLS         *tls.Config     // Terminate TLS and serve it as L7 (h2 or HTTP/1.1 by ALPN), passed through if nil
+	Timeouts    TimeoutOpts
+	// TrustedProxies lists the peers (CIDR prefixes or IPs) whose PROXY
+	// protocol headers are honored in ModeAuto. Headers from other peers are
+	// treated as an unknown protocol, so clients cannot spoof their address.
+	// ACL and ConnRateLimit are checked again on the client a header names.
+	TrustedProxies []string
+	ACL            *ACL // Checked on the peer address right after Accept, everyone allowed if nil
+	MaxConns       int  // Open client connections, further ones wait in the accept backlog; unlimited if zero
+	// ConnRateLimit limits new connections per client IP, checked as soon as
+	// they are accepted. Refused connections are closed.
+	ConnRateLimit backend.RateLimitOpts
+	// RequestRateLimit limits L7 requests by client IP, header or route.
+	// Limited requests get 429 with Retry-After.
+	RequestRateLimit backend.RateLimitOpts
+	Compression      *CompressionOpts // L7 response compression, off if nil
+	// UpgradeIdleTimeout closes upgraded (e.g. WebSocket) connections that
+	// carry no traffic in either direction for this long, defaults to 10m.
+	UpgradeIdleTimeout time.Duration
+}
+
+type TimeoutOpts struct {
+	// Handshake bounds the client's opening phase: a PROXY header, the TLS
+	// handshake and reading request headers. Defaults to 10s.
+	Handshake time.Duration
+	// Connect bounds dialing an upstream server, including its TLS
+	// handshake. Defaults to 5s.
+	Connect time.Duration
+	// Response bounds waiting for an upstream server's response headers once
+	// the request is sent. Defaults to 60s.
+	Response time.Duration
+	// Idle closes L4 connections with no traffic in either direction and L7
+	// keep-alive connections waiting for the next request. Defaults to 5m.
+	Idle time.Duration
+	// MaxLifetime closes any connection this long after it was accepted,
+	// unlimited if zero.
+	MaxLifetime time.Duration
+}
+
+func (o TimeoutOpts) withDefaults() TimeoutOpts {
+	if o.Handshake <= 0 {
+		o.Handshake = 10 * time.Second
+	}
+	if o.Connect <= 0 {
+		o.Connect = 5 * time.Second
+	}
+	if o.Response <= 0 {
+		o.Response = 60 * time.Second
+	}
+	if o.Idle <= 0 {
+		o.Idle = 5 * time.Minute
+	}
+	return o
+}
+
+// ConnHandler takes over a connection after sniffing. reader holds the bytes
+// that were peeked and must be read before conn.
+type ConnHandler func(t *TCPTransport, reader *bufio.Reader, conn net.Conn)
+
+// ProtocolRoute sends a sniffed protocol to a pool (proxied as L4) or a handler.
+type ProtocolRoute struct {
+	Pool    string
+	Handler ConnHandler
+}
+
+type SniffOpts struct {
+	// Timeout is how long to wait for the client's first bytes, defaults to
+	// 5s. A client still part way through a signature, e.g. one that has sent
+	// "GE", gets until Timeouts.Handshake.
+	Timeout time.Duration
+	// Signatures are checked before the built-in ones (HTTP/1.x, HTTP/2
+	// preface, TLS ClientHello, PROXY protocol).
+	Signatures []Signature
+	// Routes override where a protocol goes. HTTP/1.x and the HTTP/2 preface
+	// default to the L7 handler, as does TLS when the listener has a TLS
+	// config. A PROXY header from one of TrustedProxies is unwrapped and the
+	// rest sniffed again, and everything else goes to DefaultPool.
+	Routes map[Protocol]ProtocolRoute
+	// SilentPool receives clients that send nothing within Timeout, so
+	// server-first protocols (SMTP, MySQL, FTP, SSH banners) can share an
+	// auto-sniffing listener. Pair it with a short Timeout. Silent clients are
+	// closed if empty; use ModeL4 to skip sniffing entirely.
+	SilentPool string
 }
 
 type TCPTransport struct {
 	TransportOpts
 	Listener net.Listener
+
+	l7Server   *http.Server
+	l7Listener *connListener
+	slots      chan struct{} // One per open connection when MaxConns is set
+
+	connLimiter    *backend.RateLimiter
+	requestLimiter *backend.RateLimiter
+	trustedProxies []netip.Prefix
 }
 
 func NewTCPTransport(opts TransportOpts) *TCPTransport {
-	return &TCPTransport{
-		TransportOpts: opts,
+	if opts.Mode == "" {
+		opts.Mode = ModeAuto
+	}
+	opts.Timeouts = opts.Timeouts.withDefaults()
+
+	t := &TCPTransport{
+		TransportOpts:  opts,
+		connLimiter:    backend.NewRateLimiter(opts.ConnRateLimit),
+		requestLimiter: backend.NewRateLimiter(opts.RequestRateLimit),
+	}
+	if opts.MaxConns > 0 {
+		t.slots = make(chan struct{}, opts.MaxConns)
 	}
+	return t
 }
 
-type L7LBProperties struct {
-	L7Pools map[string]*backend.L7ServerPool
+type LBProperties struct {
+	Transports     []*TCPTransport
+	UDPTransports  []*UDPTransport
+	Pools          map[string]*backend.Pool
+	Balancers      map[string]*algorithm.Balancer // One strategy instance per pool
+	L7LBProperties *L7LBProperties
+
+	// upstreamTransports holds one transport per server so connections,
+	// including multiplexed HTTP/2 ones, are reused across requests.
+	upstreamTransports sync.Map // upstreamKey -> *http.Transport
 }
 
-func NewL7LBProperties(pools map[string]*backend.L7ServerPool) *L7LBProperties {
-	return &L7LBProperties{
-		L7Pools: pools,
+func NewLBProperties(Transports []*TCPTransport, Pools map[string]*backend.Pool, L7Prop *L7LBProperties) (*LBProperties, error) {
+	balancers := make(map[string]*algorithm.Balancer, len(Pools))
+	for name, pool := range Pools {
+		b, err := algorithm.NewBalancer(pool)
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: %w", name, err)
+		}
+		balancers[name] = b
+	}
+
+	p := &LBProperties{
+		Transports:     Transports,
+		Pools:          Pools,
+		Balancers:      balancers,
+		L7LBProperties: L7Prop,
 	}
+
+	for _, t := range Transports {
+		if err := p.validateTransport(t); err != nil {
+			return nil, fmt.Errorf("listener %s: %w", t.ListenAddr, err)
+		}
+	}
+
+	return p, nil
 }
 
-type LBProperties struct {
-	Transport             *TCPTransport
-	L4ServerPoolInterface algorithm.ServerPool
-	L4ServerPool          *backend.L4BackendPool
-	AlgorithmsMap         map[string]algorithm.LBStrategy
-	L7LBProperties        *L7LBProperties
+// RemoveServer takes the server at address out of the named pool and closes
+// the idle upstream connections kept for it. It reports whether the server
+// was found.
+func (p *LBProperties) RemoveServer(poolName, address string) bool {
+	pool := p.Pools[poolName]
+	if pool == nil || pool.RemoveServer(address) == nil {
+		return false
+	}
+
+	log.Printf("Removed backend %s from pool %s", address, poolName)
+	p.pruneTransports()
+	return true
+}
+
+func (p *LBProperties) validateTransport(t *TCPTransport) error {
+	trusted, err := parsePrefixes(t.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+	t.trustedProxies = trusted
+
+	switch t.Mode {
+	case ModeL4, ModeAuto:
+		if t.DefaultPool == "" {
+			return fmt.Errorf("mode %s needs a default pool", t.Mode)
+		}
+	case ModeL7:
+		if t.DefaultPool == "" && p.l7For(t) == nil {
+			return fmt.Errorf("mode %s needs L7 routes or a default pool", t.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown protocol mode %q", t.Mode)
+	}
+
+	for proto, route := range t.Sniff.Routes {
+		if route.Pool != "" && route.Handler != nil {
+			return fmt.Errorf("protocol %s: route has both a pool and a handler", proto)
+		}
+		if route.Pool != "" && p.Balancers[route.Pool] == nil {
+			return fmt.Errorf("protocol %s: unknown pool %q", proto, route.Pool)
+		}
+	}
+
+	if t.Sniff.SilentPool != "" && p.Balancers[t.Sniff.SilentPool] == nil {
+		return fmt.Errorf("unknown silent pool %q", t.Sniff.SilentPool)
+	}
+
+	if t.DefaultPool != "" && p.Balancers[t.DefaultPool] == nil {
+		return fmt.Errorf("unknown default pool %q", t.DefaultPool)
+	}
+
+	if l7 := p.l7For(t); l7 != nil {
+		for class, pool := range l7.L7Pools {
+			if p.Balancers[pool] == nil {
+				return fmt.Errorf("L7 class %s: unknown pool %q", class, pool)
+			}
+		}
+		for _, route := range l7.Routes {
+			if route.Mirror != nil && p.Balancers[route.Mirror.Pool] == nil {
+				return fmt.Errorf("route %s: unknown mirror pool %q", route.Name, route.Mirror.Pool)
+			}
+			if route.Redirect != nil {
+				if err := route.Redirect.validate(); err != nil {
+					return fmt.Errorf("route %s: %w", route.Name, err)
+				}
+			}
+			if route.Respond != nil {
+				if err := route.Respond.validate(); err != nil {
+					return fmt.Errorf("route %s: %w", route.Name, err)
+				}
+			}
+			if route.direct() {
+				continue
+			}
+			if route.Split != nil {
+				for _, b := range route.Split.Weights() {
+					if p.Balancers[b.Pool] == nil {
+						return fmt.Errorf("route %s: unknown split pool %q", route.Name, b.Pool)
+					}
+				}
+				continue
+			}
+			if p.Balancers[route.Pool] == nil {
+				return fmt.Errorf("route %s: unknown pool %q", route.Name, route.Pool)
+			}
+		}
+	}
+
+	return nil
 }
 
-func NewLBProperties(Transport TCPTransport, L4Pool backend.L4BackendPool, L7Prop *L7LBProperties) *LBProperties {
-	algoMap := map[string]algorithm.LBStrategy{
-		"round_robin":               algorithm.NewRRAlgo(),
-		"weighted_round_robin":      algorithm.NewWRRAlgo(),
-		"least_connection":          algorithm.NewLCountAlgo(),
-		"weighted_least_connection": algorithm.NewWLCountAlgo(),
+// trustsProxy reports whether addr may send a PROXY protocol header.
+func (t *TCPTransport) trustsProxy(addr net.Addr) bool {
+	ip, err := netip.ParseAddr(clientIP(addr.String()))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range t.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
+
+// limitsOnAccept reports whether the per-IP connection limit applies to addr
+// as soon as it connects. Trusted proxies are limited by the client their
+// PROXY header names instead, or by their own address if they send none.
+func (t *TCPTransport) limitsOnAccept(addr net.Addr) bool {
+	return t.Mode != ModeAuto || !t.trustsProxy(addr)
+}
 
-	L4PoolAdapter := algorithm.L4PoolAdapter{&L4Pool}
-	return &LBProperties{
-		Transport:             &Transport,
-		L4ServerPoolInterface: &L4PoolAdapter,
-		L4ServerPool:          &L4Pool,
-		AlgorithmsMap:         algoMap,
-		L7LBProperties:        L7Prop,
+func (p *LBProperties) l7For(t *TCPTransport) *L7LBProperties {
+	if t.L7 != nil {
+		return t.L7
 	}
+	return p.L7LBProperties
 }
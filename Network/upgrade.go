@@ -0,0 +1,133 @@
+package network
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultUpgradeIdleTimeout = 10 * time.Minute
+
+// upgradeType returns the protocol a request asks to switch to (e.g.
+// "websocket"), or "" if it is not an upgrade request.
+func upgradeType(h http.Header) string {
+	if !headerContainsToken(h, "Connection", "upgrade") {
+		return ""
+	}
+	return h.Get("Upgrade")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleUpgrade completes a 101 Switching Protocols response: the client
+// connection is hijacked, the response is written to it, and bytes are then
+// copied both ways until either side closes or the connection sits idle.
+func handleUpgrade(t *TCPTransport, w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	backendConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		log.Printf("[HTTP_HANDLER] Backend switched protocols without a writable body")
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer backendConn.Close()
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), upgradeType(r.Header)) {
+		log.Printf("[HTTP_HANDLER] Backend switched to %q, client asked for %q", resp.Header.Get("Upgrade"), upgradeType(r.Header))
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	clientConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Printf("[HTTP_HANDLER] Cannot hijack connection for upgrade: %v", err)
+		http.Error(w, "upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+
+	// Nothing read from the client before the hijack should carry a deadline
+	// set by the HTTP server.
+	clientConn.SetDeadline(time.Time{})
+
+	resp.Body = nil
+	if err := resp.Write(brw); err != nil {
+		log.Printf("[HTTP_HANDLER] Error writing upgrade response: %v", err)
+		return
+	}
+	if err := brw.Flush(); err != nil {
+		log.Printf("[HTTP_HANDLER] Error writing upgrade response: %v", err)
+		return
+	}
+
+	idleTimeout := t.UpgradeIdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultUpgradeIdleTimeout
+	}
+
+	log.Printf("[HTTP_HANDLER] Upgraded %s to %s", r.RemoteAddr, resp.Header.Get("Upgrade"))
+	start := time.Now()
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			clientConn.Close()
+			backendConn.Close()
+		})
+	}
+
+	done := make(chan struct{}, 2)
+	relay := func(dst io.Writer, src io.Reader) {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				lastActive.Store(time.Now().UnixNano())
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	go relay(backendConn, brw) // client → backend, including bytes already buffered
+	go relay(clientConn, backendConn)
+
+	ticker := time.NewTicker(idleTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			// One side finished; the other cannot make progress on its own.
+			closeBoth()
+			<-done
+			log.Printf("[HTTP_HANDLER] Upgraded connection from %s closed after %v", r.RemoteAddr, time.Since(start))
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, lastActive.Load())) > idleTimeout {
+				log.Printf("[HTTP_HANDLER] Upgraded connection from %s idle for %v, closing", r.RemoteAddr, idleTimeout)
+				closeBoth()
+			}
+		}
+	}
+}
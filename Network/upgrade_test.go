@@ -0,0 +1,117 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	backend "github.com/Faizan2005/Backend"
+)
+
+// startTestLB serves one listener in mode with a single pool "p" of servers.
+func startTestLB(t *testing.T, opts TransportOpts, servers ...*backend.Server) *LBProperties {
+	t.Helper()
+
+	opts.ListenAddr = "127.0.0.1:0"
+	opts.DefaultPool = "p"
+	transport := NewTCPTransport(opts)
+	pool := backend.NewPool(backend.PoolOpts{Name: "p", Servers: servers})
+
+	lb, err := NewLBProperties([]*TCPTransport{transport}, map[string]*backend.Pool{"p": pool}, NewL7LBProperties(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lb.ListenAndAccept(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { transport.Listener.Close() })
+	return lb
+}
+
+// echoUpgradeServer switches to "echo" and sends back whatever it reads.
+func echoUpgradeServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpgradeReleasesServer(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	server := backend.NewServer(backend.ServerOpts{Address: upstream.Listener.Addr().String(), Weight: 1})
+	lb := startTestLB(t, TransportOpts{Mode: ModeL7}, server)
+
+	conn, err := net.Dial("tcp", lb.Transports[0].Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: lb\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+
+	io.WriteString(conn, "ping\n")
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v", line, err)
+	}
+	if n := server.GetConnCount(); n != 1 {
+		t.Fatalf("ConnCount during upgrade = %d, want 1", n)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for server.GetConnCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ConnCount after upgrade = %d, want 0", server.GetConnCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpgradeRejectedProtocol(t *testing.T) {
+	upstream := echoUpgradeServer(t)
+	server := backend.NewServer(backend.ServerOpts{Address: upstream.Listener.Addr().String(), Weight: 1})
+	lb := startTestLB(t, TransportOpts{Mode: ModeL7}, server)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+lb.Transports[0].Listener.Addr().String()+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	if n := server.GetConnCount(); n != 0 {
+		t.Fatalf("ConnCount = %d, want 0", n)
+	}
+}
@@ -1,46 +1,72 @@
 package main
 
 import (
-	"sync"
-
 	backend "github.com/Faizan2005/Backend"
 	netw "github.com/Faizan2005/Network"
 )
 
 func main() {
-	opts := netw.TransportOpts{
-		ListenAddr: ":3000",
+	L4pool := backend.NewPool(backend.PoolOpts{
+		Name:      "tcp",
+		Servers:   backend.MakeL4TestServers(),
+		Algorithm: "weighted_least_connection",
+	})
+
+	staticPoolOpts := backend.PoolOpts{
+		Name:      "static",
+		Servers:   backend.MakeL7StaticTestServers(),
+		Algorithm: "weighted_round_robin",
 	}
 
-	transport := netw.NewTCPTransport(opts)
+	staticPool := backend.NewPool(staticPoolOpts)
 
-	L4pool := backend.L4BackendPool{
-		Servers: backend.MakeL4TestServers(),
-		Mutex:   *new(sync.RWMutex),
+	dynamicPoolOpts := backend.PoolOpts{
+		Name:      "dynamic",
+		Servers:   backend.MakeL7DynamicTestServers(),
+		Algorithm: "adaptive",
+		HTTP2:     true,
 	}
 
-	staticPoolOpts := backend.L7PoolOpts{
-		Name:    "static",
-		Servers: backend.MakeL7StaticTestServers(),
-	}
+	dynamicPool := backend.NewPool(dynamicPoolOpts)
 
-	staticPool := backend.NewL7ServerPool(staticPoolOpts)
+	udpPool := backend.NewPool(backend.PoolOpts{
+		Name:    "udp",
+		Servers: backend.MakeUDPTestServers(),
+	})
 
-	dynamicPoolOpts := backend.L7PoolOpts{
-		Name:    "dynamic",
-		Servers: backend.MakeL7DynamicTestServers(),
+	pools := map[string]*backend.Pool{
+		"tcp":     L4pool,
+		"udp":     udpPool,
+		"static":  staticPool,
+		"dynamic": dynamicPool,
 	}
 
-	dynamicPool := backend.NewL7ServerPool(dynamicPoolOpts)
+	L7Prop := netw.NewL7LBProperties(map[string]string{
+		"static":  "static",
+		"dynamic": "dynamic",
+	})
+
+	transports := []*netw.TCPTransport{
+		netw.NewTCPTransport(netw.TransportOpts{
+			ListenAddr:  ":3000",
+			Mode:        netw.ModeAuto,
+			DefaultPool: "tcp",
+		}),
+	}
 
-	L7pools := map[string]*backend.L7ServerPool{
-		"static":  staticPool,
-		"dynamic": dynamicPool,
+	p, err := netw.NewLBProperties(transports, pools, L7Prop)
+	if err != nil {
+		panic(err)
 	}
 
-	L7Prop := netw.NewL7LBProperties(L7pools)
+	udpTransport := netw.NewUDPTransport(netw.UDPTransportOpts{
+		ListenAddr: ":3053",
+		Pool:       "udp",
+	})
 
-	p := netw.NewLBProperties(*transport, L4pool, L7Prop)
+	if err := p.AddUDPTransport(udpTransport); err != nil {
+		panic(err)
+	}
 
 	if err := p.ListenAndAccept(); err != nil {
 		panic(err)
@@ -53,7 +79,7 @@ func main() {
 	// 		time.Sleep(3 * time.Second)
 	// 		fmt.Println("=== Backend Server States ===")
 	// 		for _, srv := range L4pool.Servers {
-	// 			fmt.Printf("Server: %s | ConnCount: %d\n | Weight: %d\n", srv.Address, srv.ConnCount, srv.Weight)
+	// 			fmt.Printf("Server: %s | ConnCount: %d\n | Weight: %d\n", srv.Address, srv.ConnCount.Load(), srv.Weight)
 	// 		}
 	// 		fmt.Println("=============================")
 	// 	}